@@ -6,21 +6,45 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 var (
 	human  = log.New(os.Stdout, "", 0)
-	humanf *os.File
+	humanf File
 	json   = log.New(os.Stdout, "", 0)
-	jsonf  *os.File
+	jsonf  File
 	folder string
-	prefix = "Default"
+	prefix = DefaultPrefix
 	level  = INFO
 	ctx    context.Context
 	cancel func()
+
+	compression Compression
+	compressor  *Compressor
+	retention   = DefaultRetention
+	naming      = DefaultNaming
+	coordinated bool
+	hooks       *HookRunner
+	humanOut    *Failover
+	jsonOut     *Failover
+	locks       = map[string]*FolderLock{}
+	filesystem  = OS
+	clock       = SystemClock
+	external    bool
+	// reopenMut is held while humanf and jsonf are swapped for new files
+	reopenMut sync.Mutex
+	// background are the goroutines rotating or following the log files, Closer waits for them
+	background sync.WaitGroup
+
+	// humanSeen and jsonSeen are the sizes of the log files at the last check for external truncation
+	humanSeen, jsonSeen int64
 )
 
 type Level int
@@ -45,24 +69,83 @@ func SetPrefix(p string) {
 	prefix = p
 }
 
+// Prefix returns the name of the live log files, set with SetPrefix.
+func Prefix() string {
+	return prefix
+}
+
+// SetCompression sets how rotated log files are compressed, it has to be called before SetOutputFolder.
+func SetCompression(c Compression) {
+	compression = c
+}
+
+// SetNaming sets how rotated log files are named, it has to be called before SetOutputFolder.
+func SetNaming(n Naming) {
+	naming = n
+}
+
+// SetCoordinated makes the output folder safe to share with other processes, it has to be called before SetOutputFolder.
+// Rotation, compression and truncation is serialized with an advisory lock on the folder,
+// and each process follows the rotations done by the others.
+func SetCoordinated(c bool) {
+	coordinated = c
+}
+
+// SetHooks sets the hooks called as rotated log files are compressed and deleted, it has to be called before SetOutputFolder.
+func SetHooks(h Hooks) {
+	hooks = NewHookRunner(h)
+}
+
+// SetExternalRotation leaves rotation and truncation of the output folder to an external tool like logrotate,
+// it has to be called before SetOutputFolder. The log files are reopened by path on SIGHUP or Reopen,
+// and when they have been moved or truncated underneath the process.
+func SetExternalRotation(e bool) {
+	external = e
+}
+
+// SetFS sets the filesystem the output folder is on, it has to be called before SetOutputFolder.
+func SetFS(fsys FS) {
+	filesystem = fsys
+}
+
+// SetClock sets where the logger gets the time from, it has to be called before SetOutputFolder.
+func SetClock(c Clock) {
+	clock = c
+}
+
+// Closer stops the rotation of the log files, waits for it to be done with them and closes them.
 func Closer() {
-	humanf.Close()
-	jsonf.Close()
-	cancel()
+	if cancel != nil {
+		cancel()
+	}
+	background.Wait()
+	reopenMut.Lock()
+	if humanf != nil {
+		humanf.Close()
+	}
+	if jsonf != nil {
+		jsonf.Close()
+	}
+	reopenMut.Unlock()
+	compressor.Close()
+	for _, l := range locks {
+		l.Close()
+	}
+	hooks.Wait()
 }
 
 func SetOutputFolder(path string) func() {
 	ctx, cancel = context.WithCancel(context.Background())
 	folder = path
-	if !FileExists(path) {
-		err := os.MkdirAll(path, 0755)
+	if !Exists(filesystem, path) {
+		err := filesystem.MkdirAll(path, 0755)
 		if err != nil {
 			return nil
 		}
 	}
 	jsonPath := path + "/json"
-	if !FileExists(jsonPath) {
-		err := os.MkdirAll(jsonPath, 0755)
+	if !Exists(filesystem, jsonPath) {
+		err := filesystem.MkdirAll(jsonPath, 0755)
 		if err != nil {
 			return nil
 		}
@@ -70,30 +153,68 @@ func SetOutputFolder(path string) func() {
 	var err error
 	humanf, jsonf, err = NewLogFiles(path, jsonPath)
 	if err != nil {
-		AddError(err).Error("unable to create new logfiles")
+		DefaultDiagnostics.Report(ERROR, "unable to create new logfiles", err)
 		return nil
 	}
-	human = log.New(humanf, prefix, 0)
-	json = log.New(humanf, prefix, 0)
+	humanOut = NewFailover(humanf)
+	jsonOut = NewFailover(jsonf)
+	humanOut.SetClock(clock)
+	jsonOut.SetClock(clock)
+	human = log.New(humanOut, prefix, 0)
+	// A prefix in front of the records would make them invalid json
+	json = log.New(jsonOut, "", 0)
+	if coordinated {
+		locks[path] = NewFolderLock(path)
+		locks[jsonPath] = NewFolderLock(jsonPath)
+	}
+	if compression != CompressionNone {
+		if coordinated {
+			compressor = NewCoordinatedCompressor(filesystem, compression, 10*time.Second)
+		} else {
+			compressor = NewCompressor(filesystem, compression)
+		}
+		compressor.SetClock(clock)
+		compressor.OnCompressed(func(_, path string) {
+			hooks.Compressed(path)
+		})
+		compressor.Recover(path, prefix, naming)
+		compressor.Recover(jsonPath, prefix, naming)
+	}
+	if external {
+		background.Add(1)
+		go followExternalRotation(ctx)
+		return Closer
+	}
+	background.Add(1)
 	go func() {
-		nextDay := time.Now().UTC().AddDate(0, 0, 1)
+		defer background.Done()
+		now := clock.Now().UTC()
+		nextDay := now.AddDate(0, 0, 1)
 		nextDay = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 1, time.UTC)
-		nextDayIn := nextDay.Sub(time.Now().UTC())
-		rotateTicker := time.Tick(time.Second)
-		rotateDayTicker := time.NewTicker(nextDayIn)
-		truncateTaleTicker := time.Tick(time.Second * 5)
+		nextDayIn := nextDay.Sub(now)
+		rotateTicker := clock.NewTicker(time.Second)
+		defer rotateTicker.Stop()
+		rotateDayTicker := clock.NewTicker(nextDayIn)
+		defer rotateDayTicker.Stop()
+		truncateTaleTicker := clock.NewTicker(time.Second * 5)
+		defer truncateTaleTicker.Stop()
 		firstDay := true
-		Debug("all tickers for logger is created, next day is in: ", nextDayIn)
+		DefaultDiagnostics.Report(DEBUG, "all tickers for logger is created", nil, "next_day_in", nextDayIn)
 		for {
 			select {
 			case <-ctx.Done():
-				Debug("logger done ticker selected")
+				DefaultDiagnostics.Report(DEBUG, "logger done ticker selected", nil)
 				return
-			case <-rotateTicker:
+			case <-rotateTicker.C():
 				//Debug("logger rotate ticker selected")
+				if coordinated && followRotation(path, jsonPath) {
+					continue
+				}
+				reopenMut.Lock()
 				jsonStat, err := jsonf.Stat()
+				reopenMut.Unlock()
 				if err != nil {
-					AddError(err).Error("unable to get json log file stats for rotation")
+					DefaultDiagnostics.Report(ERROR, "unable to get json log file stats for rotation", err)
 					continue
 				}
 				if jsonStat.Size() < 24*MB {
@@ -101,14 +222,14 @@ func SetOutputFolder(path string) func() {
 					continue
 				}
 				Rotate(path, jsonPath)
-			case <-rotateDayTicker.C:
+			case <-rotateDayTicker.C():
 				//Debug("logger daily rotate ticker selected")
 				if firstDay {
 					firstDay = false
 					rotateDayTicker.Reset(24 * time.Hour)
 				}
 				Rotate(path, jsonPath)
-			case <-truncateTaleTicker:
+			case <-truncateTaleTicker.C():
 				//Debug("logger truncate ticker selected")
 				TruncateTale(path)
 				TruncateTale(jsonPath)
@@ -135,13 +256,10 @@ type Stringer interface {
 	String() string
 }
 
-var jsonEscaper = strings.NewReplacer(
-	`"`, `\"`,
-)
-
+// format returns the record of s as human readable text, and as json in the layout of logstash-logback-encoder.
 func (ld logData) format(s string) (human, json string) {
-	human = time.Now().Format("15:04:05 MST")
-	json = fmt.Sprintf(`{"@timestamp":"%s"`, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+	now := clock.Now()
+	human = now.Format("15:04:05 MST")
 	var (
 		function uintptr
 		file     string
@@ -155,17 +273,28 @@ func (ld logData) format(s string) (human, json string) {
 	if ld.level == DEBUG || ld.level == CRIT {
 		human = fmt.Sprintf("%s %s:%d/%s", human, path[len(path)-1], line, runtime.FuncForPC(function).Name())
 	}
-	json = fmt.Sprintf(`%s,"data":{"file":"%s","line":%d,"function":"%s"`, json, path[len(path)-1], line, runtime.FuncForPC(function).Name())
-	if ld.err != nil {
-		json = fmt.Sprintf(`%s,"error":"%s"`, json, jsonEscaper.Replace(ld.err.Error()))
-	}
-	json = fmt.Sprintf(`%s}`, json)
 	human = fmt.Sprintf("%s [%s]%s", human, ld.level, s)
-	json = fmt.Sprintf(`%s,"level":"%s","message":"%s"`, json, ld.level, jsonEscaper.Replace(s))
 	if ld.err != nil {
 		human = fmt.Sprintf("%s. Err: %v", human, ld.err)
 	}
-	json = fmt.Sprintf("%s}", json)
+	caller := runtime.FuncForPC(function).Name()
+	pkg, _ := SplitFunction(caller)
+	r := LogstashRecord{
+		Time:    now,
+		Message: s,
+		Logger:  strings.ReplaceAll(pkg, "/", "."),
+		Thread:  GoroutineName(),
+		Caller:  caller,
+		File:    path[len(path)-1],
+		Line:    line,
+	}
+	r.Level, r.LevelValue = ld.level.logbackLevel()
+	if ld.err != nil {
+		r.StackTrace = fmt.Sprintf("%+v", ld.err)
+	}
+	// The log.Logger ends the record with the newline
+	b := AppendLogstash(nil, r)
+	json = string(b[:len(b)-1])
 	return
 }
 
@@ -175,10 +304,12 @@ func (ld logData) Print(a ...interface{}) {
 	}
 	humanString, jsonString := ld.format(fmt.Sprint(a...))
 	human.Print(humanString)
+	reportLoss(humanOut, human, false)
 	if folder == "" {
 		return
 	}
 	json.Print(jsonString)
+	reportLoss(jsonOut, json, true)
 }
 
 func (ld logData) Printf(format string, a ...interface{}) {
@@ -195,10 +326,34 @@ func (ld logData) Println(a ...interface{}) {
 	}
 	humanString, jsonString := ld.format(fmt.Sprint(a...))
 	human.Println(humanString)
+	reportLoss(humanOut, human, false)
 	if folder == "" {
 		return
 	}
 	json.Println(jsonString)
+	reportLoss(jsonOut, json, true)
+}
+
+// reportLoss logs what out dropped while writing to its file was failing, once it is written to again.
+func reportLoss(out *Failover, l *log.Logger, isJson bool) {
+	loss, ok := out.Recovered()
+	if !ok {
+		return
+	}
+	humanString, jsonString := logData{level: WARNING}.format(loss.String())
+	if isJson {
+		l.Println(jsonString)
+		return
+	}
+	l.Println(humanString)
+}
+
+// Dropped returns the number of records and bytes that have not made it to the log files, as writing to them failed.
+// They were written to stderr instead.
+func Dropped() (records, bytes int64) {
+	humanRecords, humanBytes := humanOut.Dropped()
+	jsonRecords, jsonBytes := jsonOut.Dropped()
+	return humanRecords + jsonRecords, humanBytes + jsonBytes
 }
 
 func Println(a ...interface{}) {
@@ -261,9 +416,20 @@ func Crit(a ...interface{}) {
 
 func (ld logData) Fatal(a ...interface{}) {
 	ld.Crit(a...)
+	syncFiles()
 	panic("Exiting from call to fatal")
 }
 
+// syncFiles commits the log files to disk, so nothing is lost if the process goes down.
+func syncFiles() {
+	if humanf != nil {
+		humanf.Sync()
+	}
+	if jsonf != nil {
+		jsonf.Sync()
+	}
+}
+
 func Fatal(a ...interface{}) {
 	AddError(nil).Fatal(a...)
 }
@@ -277,12 +443,20 @@ func FileExists(path string) bool {
 	return !errors.Is(err, os.ErrNotExist)
 }
 
-func NewLogFiles(path, jsonPath string) (hf *os.File, jf *os.File, err error) {
-	hf, err = os.OpenFile(fmt.Sprintf("%s/%s.log", path, prefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+// DefaultPrefix is the name of the live log files until another prefix is set.
+const DefaultPrefix = "Default"
+
+// OpenLogFile opens the live log file for prefix in dir for appending, creating it if needed.
+func OpenLogFile(fsys FS, dir, prefix string) (File, error) {
+	return fsys.OpenFile(fmt.Sprintf("%s/%s.log", dir, prefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func NewLogFiles(path, jsonPath string) (hf File, jf File, err error) {
+	hf, err = OpenLogFile(filesystem, path, prefix)
 	if err != nil {
 		return
 	}
-	jf, err = os.OpenFile(fmt.Sprintf("%s/%s.log", jsonPath, prefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	jf, err = OpenLogFile(filesystem, jsonPath, prefix)
 	if err != nil {
 		hf.Close()
 		return
@@ -296,65 +470,227 @@ func NewLogFiles(path, jsonPath string) (hf *os.File, jf *os.File, err error) {
 	return
 }
 
-func Rotate(path, jsonPath string) (hf *os.File, jf *os.File, err error) {
-	tf := time.Now().UTC().Format("2006-01-02T15:04:05")
-	oldName := humanf.Name() //fmt.Sprintf("%s/%s.log", path, prefix) //
-	err = os.Rename(oldName, strings.Replace(oldName, ".log", fmt.Sprintf("-%s.log", tf), 1))
+// ErrNoOutputFolder is returned when the log files are rotated or reopened before SetOutputFolder.
+var ErrNoOutputFolder = errors.New("no output folder is set")
+
+func Rotate(path, jsonPath string) (hf File, jf File, err error) {
+	reopenMut.Lock()
+	defer reopenMut.Unlock()
+	if humanf == nil || jsonf == nil {
+		return nil, nil, ErrNoOutputFolder
+	}
+	var rotatedHuman, rotatedJson string
+	liveHuman, liveJson := humanf.Name(), jsonf.Name()
+	// swapped is set once the files are replaced, until then the old ones may still be written to the segments
+	swapped := false
+	defer func() {
+		if !swapped {
+			return
+		}
+		if rotatedHuman != "" {
+			hooks.Rotated(liveHuman, rotatedHuman)
+			compressor.Enqueue(path, rotatedHuman)
+		}
+		if rotatedJson != "" {
+			hooks.Rotated(liveJson, rotatedJson)
+			compressor.Enqueue(jsonPath, rotatedJson)
+		}
+	}()
+	defer lockFolder(path)()
+	defer lockFolder(jsonPath)()
+	if coordinated && reopenStale() {
+		return humanf, jsonf, nil
+	}
+	now := clock.Now()
+	rotatedHuman, err = rotateTo(filesystem, liveHuman, naming, now)
 	if err != nil {
-		AddError(err).Error("unable to move old human log file")
+		DefaultDiagnostics.Report(ERROR, "unable to move old human log file", err)
 		return
 	}
-	oldName = jsonf.Name() //fmt.Sprintf("%s/%s.log", jsonPath, prefix) //
-	err = os.Rename(oldName, strings.Replace(oldName, ".log", fmt.Sprintf("-%s.log", tf), 1))
+	rotatedJson, err = rotateTo(filesystem, liveJson, naming, now)
 	if err != nil {
-		AddError(err).Error("unable to move old json log file")
+		DefaultDiagnostics.Report(ERROR, "unable to move old json log file", err)
 		return
 	}
 	hf, jf, err = NewLogFiles(path, jsonPath)
 	if err != nil {
-		AddError(err).Error("unable to create new logfiles")
+		DefaultDiagnostics.Report(ERROR, "unable to create new logfiles", err)
 		return
 	}
 	oldHumanf := humanf
 	oldJsonf := jsonf
 	humanf = hf
 	jsonf = jf
-	human.SetOutput(humanf)
-	json.SetOutput(jsonf)
+	humanOut.SetFile(humanf)
+	jsonOut.SetFile(jsonf)
 	oldHumanf.Close()
 	oldJsonf.Close()
+	swapped = true
 	return
 }
 
-func TruncateTale(path string) {
-	files, err := os.ReadDir(path)
+// Reopen opens the log files again by path, so writes go to whatever file is there now.
+func Reopen() (err error) {
+	reopenMut.Lock()
+	defer reopenMut.Unlock()
+	if humanf == nil || jsonf == nil {
+		return ErrNoOutputFolder
+	}
+	hf, err := ReopenFile(filesystem, humanf)
 	if err != nil {
-		AddError(err).Error("could not read dir for logs")
 		return
 	}
-	numFiles := 0
-	var oldestFile os.FileInfo
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		numFiles++
-		fi, err := file.Info()
-		if err != nil {
-			AddError(err).Error("cannot convert direntry to fileinfo in ls of log dir")
-			continue
-		}
-		if oldestFile == nil || fi.ModTime().Before(oldestFile.ModTime()) {
-			oldestFile = fi
+	jf, err := ReopenFile(filesystem, jsonf)
+	if err != nil {
+		hf.Close()
+		return
+	}
+	oldHumanf := humanf
+	oldJsonf := jsonf
+	humanf = hf
+	jsonf = jf
+	humanOut.SetFile(humanf)
+	jsonOut.SetFile(jsonf)
+	oldHumanf.Close()
+	oldJsonf.Close()
+	humanSeen, jsonSeen = 0, 0
+	return
+}
+
+// followExternalRotation reopens the log files on SIGHUP and when an external tool has moved them away,
+// and notes when they have been truncated, until ctx is done.
+func followExternalRotation(ctx context.Context) {
+	defer background.Done()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			DefaultDiagnostics.Report(DEBUG, "logger done ticker selected", nil)
+			return
+		case <-hup:
+			err := Reopen()
+			if err != nil {
+				DefaultDiagnostics.Report(ERROR, "unable to reopen log files", err)
+			}
+		case <-ticker.C():
+			reopenMut.Lock()
+			if reopenStale() {
+				humanSeen, jsonSeen = 0, 0
+			}
+			var humanTruncated, jsonTruncated bool
+			var err error
+			humanSeen, humanTruncated, err = Truncated(humanf, humanSeen)
+			if err != nil {
+				DefaultDiagnostics.Report(WARNING, "unable to check if human log file was truncated", err)
+			}
+			jsonSeen, jsonTruncated, err = Truncated(jsonf, jsonSeen)
+			if err != nil {
+				DefaultDiagnostics.Report(WARNING, "unable to check if json log file was truncated", err)
+			}
+			reopenMut.Unlock()
+			if humanTruncated || jsonTruncated {
+				DefaultDiagnostics.Report(NOTICE, "log files were truncated by an external tool, continuing at the start of the files", nil)
+			}
 		}
 	}
-	if numFiles < 12 {
+}
+
+// lockFolder locks dir if it is coordinated with other processes and returns the matching unlock.
+func lockFolder(dir string) (unlock func()) {
+	l := locks[dir]
+	err := l.Lock()
+	if err != nil {
+		DefaultDiagnostics.Report(WARNING, "unable to lock log folder", err)
+		return func() {}
+	}
+	return func() {
+		l.Unlock()
+	}
+}
+
+// followRotation reopens the log files if another process has rotated them away.
+func followRotation(path, jsonPath string) bool {
+	reopenMut.Lock()
+	defer reopenMut.Unlock()
+	defer lockFolder(path)()
+	defer lockFolder(jsonPath)()
+	return reopenStale()
+}
+
+// reopenStale reopens the log files rotated away by another process, the folders have to be locked.
+func reopenStale() bool {
+	hf, humanReopened, err := ReopenIfStale(filesystem, humanf)
+	if err != nil {
+		DefaultDiagnostics.Report(WARNING, "unable to check if human log file was rotated by another process", err)
+	}
+	if humanReopened {
+		old := humanf
+		humanf = hf
+		humanOut.SetFile(humanf)
+		old.Close()
+	}
+	jf, jsonReopened, err := ReopenIfStale(filesystem, jsonf)
+	if err != nil {
+		DefaultDiagnostics.Report(WARNING, "unable to check if json log file was rotated by another process", err)
+	}
+	if jsonReopened {
+		old := jsonf
+		jsonf = jf
+		jsonOut.SetFile(jsonf)
+		old.Close()
+	}
+	return humanReopened || jsonReopened
+}
+
+// RotateFile moves f aside to a segment named by n for the time t and opens a new file at its path.
+// f is not closed, that is left to the caller once nothing writes to it anymore.
+func RotateFile(fsys FS, f File, n Naming, t time.Time) (nf File, rotated string, err error) {
+	rotated, err = rotateTo(fsys, f.Name(), n, t)
+	if err != nil {
 		return
 	}
-	//Debug("logger truncating logfiles at path: ", path)
-	err = os.Remove(fmt.Sprintf("%s/%s", path, oldestFile.Name()))
+	nf, err = ReopenFile(fsys, f)
+	return
+}
+
+// rotateTo moves the live file at name to the segment named by n for the time t and returns the segment path.
+func rotateTo(fsys FS, name string, n Naming, t time.Time) (rotated string, err error) {
+	rotated, err = n.SegmentPath(fsys, filepath.Dir(name), strings.TrimSuffix(filepath.Base(name), ".log"), t)
+	if err != nil {
+		return "", err
+	}
+	if segmentExists(fsys, rotated) {
+		return "", ErrSegmentExists
+	}
+	err = fsys.MkdirAll(filepath.Dir(rotated), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = fsys.Rename(name, rotated)
+	if err != nil {
+		return "", err
+	}
+	return
+}
+
+// SetRetention sets which rotated log files TruncateTale keeps, it defaults to DefaultRetention.
+func SetRetention(r Retention) {
+	retention = r
+}
+
+// TruncateTale removes the rotated log files in path that fall outside the retention set with SetRetention.
+func TruncateTale(path string) {
+	defer lockFolder(path)()
+	removed, err := ApplyRetention(filesystem, path, prefix, naming, retention, clock.Now(), hooks)
+	if len(removed) > 0 {
+		DefaultDiagnostics.Report(NOTICE, "removed old log segments", nil, "dir", path, "segments", removed)
+	}
 	if err != nil {
-		AddError(err).Error("unable to remove old log file")
+		DefaultDiagnostics.Report(ERROR, "unable to remove old log file", err)
 		return
 	}
 }
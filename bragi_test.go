@@ -1,7 +1,12 @@
 package bragi
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -24,3 +29,66 @@ func TestLongRunning(t *testing.T) {
 		i++
 	}
 }
+
+func TestCloserWithoutOutputFolder(t *testing.T) {
+	Closer()
+	Closer()
+}
+
+func TestReopenWithoutOutputFolder(t *testing.T) {
+	if err := Reopen(); !errors.Is(err, ErrNoOutputFolder) {
+		t.Errorf("expected ErrNoOutputFolder, got %v", err)
+	}
+	if _, _, err := Rotate("./log", "./log/json"); !errors.Is(err, ErrNoOutputFolder) {
+		t.Errorf("expected ErrNoOutputFolder from Rotate, got %v", err)
+	}
+}
+
+// failRenameFS fails to rename files out of dir.
+type failRenameFS struct {
+	FS
+	dir string
+}
+
+func (f failRenameFS) Rename(oldpath, newpath string) error {
+	if filepath.Dir(oldpath) == f.dir {
+		return fs.ErrPermission
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func TestRotateFailingJson(t *testing.T) {
+	fsys := NewMemFS()
+	var rotated atomic.Int64
+	SetFS(failRenameFS{FS: fsys, dir: "/logs/json"})
+	SetClock(NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	SetCompression(CompressionGzip)
+	SetHooks(Hooks{OnRotate: func(_, _ string) { rotated.Add(1) }})
+	defer func() {
+		folder, humanf, jsonf, compressor = "", nil, nil, nil
+		SetFS(OS)
+		SetClock(SystemClock)
+		SetCompression(CompressionNone)
+		SetHooks(Hooks{})
+	}()
+	closer := SetOutputFolder("/logs")
+	if closer == nil {
+		t.Fatal("expected the output folder to be set")
+	}
+	if _, _, err := Rotate("/logs", "/logs/json"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected the json rename to fail, got %v", err)
+	}
+	closer()
+	if n := rotated.Load(); n != 0 {
+		t.Errorf("expected no rotation to be reported, got %d", n)
+	}
+	entries, err := fsys.ReadDir("/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), CompressionGzip.Ext()) {
+			t.Errorf("expected the human segment that is still written to not be compressed, found %s", e.Name())
+		}
+	}
+}
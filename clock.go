@@ -0,0 +1,240 @@
+package bragi
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is where the loggers get the time from, for timestamps, rotation schedules and every timer and ticker.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Timer is a time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// SystemClock is the real time of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{t: time.NewTicker(d)}
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{t: time.NewTimer(d)}
+}
+
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time   { return t.t.C }
+func (t systemTicker) Reset(d time.Duration) { t.t.Reset(d) }
+func (t systemTicker) Stop()                 { t.t.Stop() }
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time        { return t.t.C }
+func (t systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+func (t systemTimer) Stop() bool                 { return t.t.Stop() }
+
+// sleep waits for d on clock.
+func sleep(clock Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := clock.NewTimer(d)
+	defer t.Stop()
+	<-t.C()
+}
+
+// FakeClock is a Clock for tests that only moves when it is told to.
+// Like their time counterparts, its tickers and timers drop ticks nobody is receiving.
+type FakeClock struct {
+	mut     sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock *FakeClock
+	c     chan time.Time
+	at    time.Time
+	// period is zero for timers
+	period time.Duration
+	active bool
+}
+
+// NewFakeClock returns a FakeClock standing still at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mut)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.now
+}
+
+// Advance moves the clock d forward and fires every ticker and timer due by then.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to now and fires every ticker and timer due by then.
+func (c *FakeClock) Set(now time.Time) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.set(now)
+}
+
+func (c *FakeClock) set(now time.Time) {
+	c.now = now
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.active {
+			continue
+		}
+		if w.at.After(now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		select {
+		case w.c <- now:
+		default:
+		}
+		if w.period <= 0 {
+			w.active = false
+			continue
+		}
+		for !w.at.After(now) {
+			w.at = w.at.Add(w.period)
+		}
+		waiters = append(waiters, w)
+	}
+	c.waiters = waiters
+	c.cond.Broadcast()
+}
+
+// BlockUntil waits until at least n tickers and timers are waiting on the clock, so a test can
+// advance it knowing the code under test is ready for it.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	w := c.add(d, 0)
+	if d <= 0 {
+		c.Advance(0)
+	}
+	return fakeTimer{w}
+}
+
+func (c *FakeClock) add(d, period time.Duration) *fakeWaiter {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	w := &fakeWaiter{
+		clock:  c,
+		c:      make(chan time.Time, 1),
+		at:     c.now.Add(d),
+		period: period,
+		active: true,
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w
+}
+
+// reset makes w wait for d from now and reports if it was still waiting.
+func (w *fakeWaiter) reset(d time.Duration) bool {
+	c := w.clock
+	c.mut.Lock()
+	active := w.active
+	w.at = c.now.Add(d)
+	if w.period > 0 {
+		w.period = d
+	}
+	if !active {
+		w.active = true
+		c.waiters = append(c.waiters, w)
+		c.cond.Broadcast()
+	}
+	c.mut.Unlock()
+	if d <= 0 {
+		c.Advance(0)
+	}
+	return active
+}
+
+func (w *fakeWaiter) stop() bool {
+	c := w.clock
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	active := w.active
+	w.active = false
+	for i, o := range c.waiters {
+		if o == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	return active
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// fakeTicker and fakeTimer give the waiters the method sets of Ticker and Timer.
+type fakeTicker struct{ *fakeWaiter }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.reset(d)
+}
+
+func (t fakeTicker) Stop() { t.stop() }
+
+type fakeTimer struct{ *fakeWaiter }
+
+func (t fakeTimer) Reset(d time.Duration) bool { return t.reset(d) }
+func (t fakeTimer) Stop() bool                 { return t.stop() }
@@ -0,0 +1,56 @@
+package bragi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	ticker := c.NewTicker(time.Second)
+	timer := c.NewTimer(time.Minute)
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker fired early")
+	default:
+	}
+	// Ticks nobody receives are dropped, like with time.Ticker
+	c.Advance(3 * time.Second)
+	if now := <-ticker.C(); !now.Equal(start.Add(3500 * time.Millisecond)) {
+		t.Errorf("expected the tick at the current time, got %s", now)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("expected missed ticks to be dropped")
+	default:
+	}
+	c.Advance(500 * time.Millisecond)
+	<-ticker.C()
+
+	if !timer.Stop() {
+		t.Error("expected the timer to be active")
+	}
+	c.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if timer.Reset(time.Second) {
+		t.Error("expected the timer to be stopped")
+	}
+	c.Advance(time.Second)
+	<-timer.C()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sleep(c, time.Minute)
+	}()
+	c.BlockUntil(2)
+	c.Advance(time.Minute)
+	<-done
+}
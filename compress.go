@@ -0,0 +1,301 @@
+package bragi
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+func (c Compression) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Compression) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "gzip":
+		*c = CompressionGzip
+	case "zstd":
+		*c = CompressionZstd
+	case "none", "":
+		*c = CompressionNone
+	default:
+		return fmt.Errorf("unknown compression %q", text)
+	}
+	return nil
+}
+
+// Ext returns the file extension added to segments compressed with c.
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (c Compression) writer(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+// Compressor compresses rotated segments in the background so rotation never waits on it.
+// A nil Compressor, or one using CompressionNone, ignores everything it is given.
+type Compressor struct {
+	fsys        FS
+	compression Compression
+	queue       chan queuedSegment
+	done        chan struct{}
+	closed      bool
+	coordinated bool
+	delay       time.Duration
+	// compressed and clock are read by run, which must never wait on mut, as Enqueue holds it while the queue is full
+	compressed atomic.Pointer[func(dir, path string)]
+	clock      atomic.Pointer[Clock]
+	// mut is held for reading while segments are enqueued, and for writing when the queue is closed
+	mut sync.RWMutex
+}
+
+type queuedSegment struct {
+	dir  string
+	path string
+	at   time.Time
+}
+
+func NewCompressor(fsys FS, c Compression) *Compressor {
+	cmp := &Compressor{
+		fsys:        fsys,
+		compression: c,
+		queue:       make(chan queuedSegment, 64),
+		done:        make(chan struct{}),
+	}
+	cmp.clock.Store(&SystemClock)
+	go cmp.run()
+	return cmp
+}
+
+// NewCoordinatedCompressor returns a Compressor for folders shared with other processes.
+// Every segment is compressed while holding the folder lock, and not before delay has passed,
+// so writers in other processes have had time to move on to the new segment.
+func NewCoordinatedCompressor(fsys FS, c Compression, delay time.Duration) *Compressor {
+	cmp := NewCompressor(fsys, c)
+	cmp.coordinated = true
+	cmp.delay = delay
+	return cmp
+}
+
+func (c *Compressor) run() {
+	defer close(c.done)
+	for s := range c.queue {
+		clock := *c.clock.Load()
+		sleep(clock, s.at.Sub(clock.Now()))
+		err := c.compress(s.dir, s.path)
+		if err != nil {
+			DefaultDiagnostics.Report(ERROR, "unable to compress rotated log file", err, "path", s.path)
+			continue
+		}
+		if compressed := c.compressed.Load(); compressed != nil {
+			(*compressed)(s.dir, s.path+c.compression.Ext())
+		}
+	}
+}
+
+// OnCompressed registers fn to be called from the compressor with every segment it has compressed.
+// dir is the folder the segment was enqueued with and path is the compressed file.
+func (c *Compressor) OnCompressed(fn func(dir, path string)) {
+	if c == nil {
+		return
+	}
+	c.compressed.Store(&fn)
+}
+
+// SetClock sets where the compressor gets the time from when delaying segments, it defaults to SystemClock.
+func (c *Compressor) SetClock(clock Clock) {
+	if c == nil {
+		return
+	}
+	c.clock.Store(&clock)
+}
+
+func (c *Compressor) compress(dir, path string) error {
+	if !c.coordinated {
+		return CompressFile(c.fsys, path, c.compression)
+	}
+	l := NewFolderLock(dir)
+	defer l.Close()
+	err := l.Lock()
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	err = CompressFile(c.fsys, path, c.compression)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // Already compressed or removed by another process
+	}
+	return err
+}
+
+// Enqueue schedules a rotated segment in the log folder dir for compression. It must never be given the live file.
+func (c *Compressor) Enqueue(dir, path string) {
+	if c == nil || c.compression == CompressionNone {
+		return
+	}
+	// Holding mut for reading keeps Close from closing the queue under a send, while the compressor
+	// goroutine keeps draining the queue without it
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.closed {
+		return
+	}
+	c.queue <- queuedSegment{
+		dir:  dir,
+		path: path,
+		at:   (*c.clock.Load()).Now().Add(c.delay),
+	}
+}
+
+// Recover removes half written compressed files left in dir by a crash and queues
+// every uncompressed rotated segment belonging to prefix.
+func (c *Compressor) Recover(dir, prefix string, n Naming) {
+	if c == nil || c.compression == CompressionNone {
+		return
+	}
+	// Enqueuing is done without the folder lock, as the queue can be full of segments waiting for it
+	for _, path := range c.recover(dir, prefix, n) {
+		c.Enqueue(dir, path)
+	}
+}
+
+func (c *Compressor) recover(dir, prefix string, n Naming) (pending []string) {
+	if c.coordinated {
+		l := NewFolderLock(dir)
+		defer l.Close()
+		err := l.Lock()
+		if err != nil {
+			DefaultDiagnostics.Report(ERROR, "unable to lock log folder", err, "dir", dir)
+			return
+		}
+		defer l.Unlock()
+	}
+	err := walkSegments(c.fsys, dir, n, func(rel string, _ fs.DirEntry) {
+		path := filepath.Join(dir, rel)
+		if partial, ok := strings.CutSuffix(rel, ".tmp"); ok {
+			if isSegment(partial, prefix, n) {
+				err := c.fsys.Remove(path)
+				if err != nil {
+					DefaultDiagnostics.Report(ERROR, "unable to remove partially compressed log file", err, "path", path)
+				}
+			}
+			return
+		}
+		if _, comp := trimCompressionExt(rel); comp != CompressionNone {
+			return
+		}
+		if !isSegment(rel, prefix, n) {
+			return
+		}
+		pending = append(pending, path)
+	})
+	if err != nil {
+		DefaultDiagnostics.Report(ERROR, "could not read dir for logs", err, "dir", dir)
+	}
+	return
+}
+
+// Close waits for all queued segments to be compressed. It is safe to call more than once.
+func (c *Compressor) Close() {
+	if c == nil {
+		return
+	}
+	c.mut.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mut.Unlock()
+	<-c.done
+}
+
+// CompressFile writes path compressed with c next to it and removes the original.
+// The data is written to a .tmp file first so a crash never leaves a truncated segment behind.
+func CompressFile(fsys FS, path string, c Compression) (err error) {
+	in, err := fsys.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	name := path + c.Ext()
+	tmp := name + ".tmp"
+	out, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			fsys.Remove(tmp)
+		}
+	}()
+	w, err := c.writer(out)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(w, in)
+	if err != nil {
+		return
+	}
+	err = w.Close()
+	if err != nil {
+		return
+	}
+	err = out.Sync()
+	if err != nil {
+		return
+	}
+	err = out.Close()
+	if err != nil {
+		return
+	}
+	err = fsys.Rename(tmp, name)
+	if err != nil {
+		return
+	}
+	return fsys.Remove(path)
+}
@@ -0,0 +1,90 @@
+package bragi
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompressorRecover(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "app.log")
+	rotated := filepath.Join(dir, "app-2026-10-18T10:00:00.log")
+	partial := rotated + ".gz.tmp"
+	other := filepath.Join(dir, "other-2026-10-18T10:00:00.log")
+	for _, name := range []string{live, rotated, partial, other} {
+		if err := os.WriteFile(name, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCompressor(OS, CompressionGzip)
+	c.Recover(dir, "app", DefaultNaming)
+	c.Close()
+
+	for _, name := range []string{rotated, partial} {
+		if FileExists(name) {
+			t.Errorf("%s should have been removed", name)
+		}
+	}
+	for _, name := range []string{live, other} {
+		if !FileExists(name) {
+			t.Errorf("%s should not have been touched", name)
+		}
+	}
+	f, err := os.Open(rotated + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line\n" {
+		t.Errorf("compressed segment contained %q", data)
+	}
+}
+
+func TestCompressorFullQueue(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 200; i++ {
+		path, err := DefaultNaming.SegmentPath(fsys, "/logs", "app", start.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = fsys.WriteFile(path, []byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCompressor(fsys, CompressionGzip)
+	var compressed atomic.Int64
+	c.OnCompressed(func(_, _ string) {
+		compressed.Add(1)
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Recover("/logs", "app", DefaultNaming)
+		c.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected enqueuing more segments than the queue holds to not deadlock")
+	}
+	if n := compressed.Load(); n != 200 {
+		t.Errorf("expected 200 compressed segments, got %d", n)
+	}
+}
@@ -0,0 +1,184 @@
+package bragi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiagnosticsBurst = 10
+	defaultDiagnosticsEvery = time.Second
+	recentDiagnostics       = 64
+)
+
+// Diagnostic is a failure, or a note, from the logging code itself.
+type Diagnostic struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Err     error
+	// Args are key value pairs giving context, like the arguments of a log call
+	Args []any
+}
+
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	sb.WriteByte(' ')
+	sb.WriteString(d.Level.String())
+	sb.WriteByte(' ')
+	sb.WriteString(d.Message)
+	if d.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(d.Err.Error())
+	}
+	for i := 0; i < len(d.Args); i += 2 {
+		if i+1 == len(d.Args) {
+			fmt.Fprintf(&sb, " %v", d.Args[i])
+			break
+		}
+		fmt.Fprintf(&sb, " %v=%v", d.Args[i], d.Args[i+1])
+	}
+	return sb.String()
+}
+
+// Diagnostics reports what goes wrong inside the loggers without going through them, so a failing log file
+// can not feed back into itself. Reports are written to an output with a rate limit, and the most recent ones
+// are kept to be looked at with Recent.
+type Diagnostics struct {
+	mut   sync.Mutex
+	out   io.Writer
+	level Level
+	clock Clock
+	// burst reports are written at once, after that one every every
+	burst      int
+	every      time.Duration
+	tokens     int
+	refilled   time.Time
+	suppressed int
+	// recent is a ring of the last reports, next is where the next one goes
+	recent []Diagnostic
+	next   int
+}
+
+// DefaultDiagnostics is where bragi and sbragi report their own failures, it writes to stderr.
+var DefaultDiagnostics = NewDiagnostics(os.Stderr)
+
+// NewDiagnostics returns Diagnostics writing to out, reporting NOTICE and above, and writing at most
+// ten reports at once and one a second after that.
+func NewDiagnostics(out io.Writer) *Diagnostics {
+	return &Diagnostics{
+		out:    out,
+		level:  NOTICE,
+		clock:  SystemClock,
+		burst:  defaultDiagnosticsBurst,
+		every:  defaultDiagnosticsEvery,
+		tokens: defaultDiagnosticsBurst,
+	}
+}
+
+// SetOutput sets where reports are written, nil only keeps them for Recent.
+func (d *Diagnostics) SetOutput(w io.Writer) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.out = w
+}
+
+// SetLevel sets the lowest level that is reported, anything below it is ignored.
+func (d *Diagnostics) SetLevel(l Level) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.level = l
+}
+
+// SetRateLimit writes at most burst reports at once and one every every after that. The reports over the limit
+// are counted and still kept for Recent. A burst of zero or less writes every report.
+func (d *Diagnostics) SetRateLimit(burst int, every time.Duration) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.burst = burst
+	d.every = every
+	d.tokens = burst
+	d.refilled = d.clock.Now()
+}
+
+// SetClock sets where the reports get their time from, it defaults to SystemClock.
+func (d *Diagnostics) SetClock(c Clock) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.clock = c
+	d.refilled = c.Now()
+}
+
+// Report reports msg with err, which can be nil, and key value pairs in args.
+func (d *Diagnostics) Report(level Level, msg string, err error, args ...any) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if level < d.level {
+		return
+	}
+	diag := Diagnostic{
+		Time:    d.clock.Now(),
+		Level:   level,
+		Message: msg,
+		Err:     err,
+		Args:    args,
+	}
+	if len(d.recent) < recentDiagnostics {
+		d.recent = append(d.recent, diag)
+	} else {
+		d.recent[d.next] = diag
+	}
+	d.next = (d.next + 1) % recentDiagnostics
+	if d.out == nil {
+		return
+	}
+	if !d.allow(diag.Time) {
+		d.suppressed++
+		return
+	}
+	if d.suppressed > 0 {
+		fmt.Fprintf(d.out, "bragi: %d diagnostics suppressed by the rate limit\n", d.suppressed)
+		d.suppressed = 0
+	}
+	fmt.Fprintf(d.out, "bragi: %s\n", diag)
+}
+
+// allow takes a token for a report at now, if there is one.
+func (d *Diagnostics) allow(now time.Time) bool {
+	if d.burst <= 0 {
+		return true
+	}
+	if d.every > 0 && d.tokens < d.burst {
+		if d.refilled.IsZero() {
+			d.refilled = now
+		}
+		refill := int(now.Sub(d.refilled) / d.every)
+		if refill > 0 {
+			d.tokens = min(d.burst, d.tokens+refill)
+			d.refilled = d.refilled.Add(time.Duration(refill) * d.every)
+		}
+	}
+	if d.tokens == 0 {
+		return false
+	}
+	if d.tokens == d.burst {
+		d.refilled = now
+	}
+	d.tokens--
+	return true
+}
+
+// Recent returns the last reports, oldest first.
+func (d *Diagnostics) Recent() []Diagnostic {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if len(d.recent) < recentDiagnostics {
+		return append([]Diagnostic(nil), d.recent...)
+	}
+	return append(append([]Diagnostic(nil), d.recent[d.next:]...), d.recent[:d.next]...)
+}
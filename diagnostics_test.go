@@ -0,0 +1,54 @@
+package bragi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics(t *testing.T) {
+	var out bytes.Buffer
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	d := NewDiagnostics(&out)
+	d.SetClock(clock)
+	d.SetRateLimit(2, time.Second)
+
+	d.Report(DEBUG, "ignored", nil)
+	d.Report(ERROR, "unable to rotate", errors.New("disk full"), "stream", "human")
+	d.Report(ERROR, "second", nil)
+	d.Report(ERROR, "over the limit", nil)
+	d.Report(ERROR, "over the limit", nil)
+	clock.Advance(time.Second)
+	d.Report(WARNING, "after a second", nil)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		"bragi: 2024-01-02T03:04:05.000Z ERROR unable to rotate: disk full stream=human",
+		"bragi: 2024-01-02T03:04:05.000Z ERROR second",
+		"bragi: 2 diagnostics suppressed by the rate limit",
+		"bragi: 2024-01-02T03:04:06.000Z WARNING after a second",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), out.String())
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], lines[i])
+		}
+	}
+
+	recent := d.Recent()
+	if len(recent) != 5 || recent[0].Message != "unable to rotate" || recent[4].Message != "after a second" {
+		t.Errorf("expected every report above the level to be kept, got %v", recent)
+	}
+	d.SetOutput(nil)
+	for range 2 * recentDiagnostics {
+		d.Report(CRIT, "flood", nil)
+	}
+	recent = d.Recent()
+	if len(recent) != recentDiagnostics || recent[0].Message != "flood" {
+		t.Errorf("expected only the last %d reports to be kept, got %d", recentDiagnostics, len(recent))
+	}
+}
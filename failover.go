@@ -0,0 +1,157 @@
+package bragi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	failoverMinBackoff = 100 * time.Millisecond
+	failoverMaxBackoff = 30 * time.Second
+)
+
+// Loss is what was dropped from a log file while writing to it was failing.
+type Loss struct {
+	Records int64
+	Bytes   int64
+	From    time.Time
+	To      time.Time
+}
+
+func (l Loss) String() string {
+	return fmt.Sprintf("%d records lost between %s and %s", l.Records, l.From.Format(time.RFC3339Nano), l.To.Format(time.RFC3339Nano))
+}
+
+// Failover writes to a log file and falls back to stderr while writing to the file is failing.
+// The file is retried with an exponential backoff, and what was dropped from it in the meantime
+// is counted and reported by Recovered once it is written to again.
+type Failover struct {
+	mut       sync.Mutex
+	file      io.Writer
+	fallback  io.Writer
+	failing   bool
+	backoff   time.Duration
+	retryAt   time.Time
+	loss      Loss
+	recovered *Loss
+	records   int64
+	bytes     int64
+	clock     Clock
+}
+
+func NewFailover(file io.Writer) *Failover {
+	return &Failover{
+		file:     file,
+		fallback: os.Stderr,
+		clock:    SystemClock,
+	}
+}
+
+// SetFile swaps the log file written to, a failing file is retried right away.
+func (f *Failover) SetFile(file io.Writer) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.file = file
+	f.retryAt = time.Time{}
+}
+
+// SetFallback sets where records go while the file is failing, it defaults to stderr.
+func (f *Failover) SetFallback(w io.Writer) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.fallback = w
+}
+
+// SetClock sets where the failover gets the time from for backoff and loss reports, it defaults to SystemClock.
+func (f *Failover) SetClock(clock Clock) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.clock = clock
+}
+
+// Write writes p to the file, or to the fallback while the file is failing.
+// It only returns an error if p could not be written to either of them.
+func (f *Failover) Write(p []byte) (n int, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	now := f.clock.Now()
+	if !f.failing || !now.Before(f.retryAt) {
+		n, err = f.file.Write(p)
+		if err == nil {
+			f.recover()
+			return
+		}
+		f.fail(now)
+	}
+	// Buffered writes hold many records, each ending with a newline
+	records := max(int64(bytes.Count(p, []byte{'\n'})), 1)
+	f.loss.Records += records
+	f.loss.Bytes += int64(len(p))
+	f.loss.To = now
+	f.records += records
+	f.bytes += int64(len(p))
+	n, fallbackErr := f.fallback.Write(p)
+	if fallbackErr != nil {
+		if err == nil {
+			err = fallbackErr
+		}
+		return n, err
+	}
+	return len(p), nil
+}
+
+func (f *Failover) fail(now time.Time) {
+	if !f.failing {
+		f.failing = true
+		f.backoff = failoverMinBackoff
+		f.loss = Loss{From: now}
+	} else {
+		f.backoff = min(2*f.backoff, failoverMaxBackoff)
+	}
+	f.retryAt = now.Add(f.backoff)
+}
+
+func (f *Failover) recover() {
+	if !f.failing {
+		return
+	}
+	f.failing = false
+	if f.recovered != nil {
+		// The last outage was never reported, so it is merged into this one
+		f.loss.Records += f.recovered.Records
+		f.loss.Bytes += f.recovered.Bytes
+		f.loss.From = f.recovered.From
+	}
+	loss := f.loss
+	f.recovered = &loss
+}
+
+// Recovered returns what was dropped from the file during the last outage, once the file is written to again.
+// Each outage is only returned once.
+func (f *Failover) Recovered() (Loss, bool) {
+	if f == nil {
+		return Loss{}, false
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.recovered == nil {
+		return Loss{}, false
+	}
+	loss := *f.recovered
+	f.recovered = nil
+	return loss, true
+}
+
+// Dropped returns the number of records and bytes that have not made it to the file in total.
+func (f *Failover) Dropped() (records, bytes int64) {
+	if f == nil {
+		return 0, 0
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.records, f.bytes
+}
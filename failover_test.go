@@ -0,0 +1,62 @@
+package bragi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+type flakyWriter struct {
+	bytes.Buffer
+	failing bool
+	calls   int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.failing {
+		return 0, errors.New("no space left on device")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestFailover(t *testing.T) {
+	file := &flakyWriter{failing: true}
+	var fallback bytes.Buffer
+	f := NewFailover(file)
+	f.SetFallback(&fallback)
+	for range 3 {
+		if _, err := f.Write([]byte("record\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if file.calls != 1 {
+		t.Errorf("expected the file to be retried after the backoff only, it was written to %d times", file.calls)
+	}
+	if fallback.String() != "record\nrecord\nrecord\n" {
+		t.Errorf("expected the records in the fallback, got %q", fallback.String())
+	}
+	if records, bytes := f.Dropped(); records != 3 || bytes != 21 {
+		t.Errorf("expected 3 records and 21 bytes dropped, got %d and %d", records, bytes)
+	}
+	if _, ok := f.Recovered(); ok {
+		t.Error("expected no recovery while the file is failing")
+	}
+
+	file.failing = false
+	time.Sleep(failoverMinBackoff)
+	if _, err := f.Write([]byte("back\n")); err != nil {
+		t.Fatal(err)
+	}
+	if file.String() != "back\n" {
+		t.Errorf("expected the file to be written to again, got %q", file.String())
+	}
+	loss, ok := f.Recovered()
+	if !ok || loss.Records != 3 || loss.Bytes != 21 || loss.To.Before(loss.From) {
+		t.Errorf("expected the loss of 3 records to be reported once, got %v %v", loss, ok)
+	}
+	if _, ok := f.Recovered(); ok {
+		t.Error("expected the loss to only be reported once")
+	}
+}
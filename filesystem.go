@@ -0,0 +1,100 @@
+package bragi
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// File is an open log file.
+type File interface {
+	io.ReadWriteCloser
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Sync() error
+}
+
+// FS is the filesystem log folders live on. OS is the default, and MemFS keeps everything in memory,
+// so rotation, retention and crashes can be tested without touching the disk.
+type FS interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+}
+
+// symlinkFS is implemented by filesystems that support the current.log symlink.
+type symlinkFS interface {
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+}
+
+// OS is the filesystem of the operating system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// Keeps a nil *os.File from becoming a non nil File
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// Exists reports if anything exists at path in fsys.
+func Exists(fsys FS, path string) bool {
+	_, err := fsys.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// ReadFile reads the whole file at name in fsys.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// SameFile reports if a and b describe the same file, for files from any FS.
+func SameFile(a, b fs.FileInfo) bool {
+	if os.SameFile(a, b) {
+		return true
+	}
+	n, ok := a.Sys().(*memNode)
+	return ok && n == b.Sys()
+}
@@ -2,32 +2,32 @@ package bragi
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"strings"
 	"time"
 )
 
 func StartRotate(done <-chan func()) {
-	ticker := time.NewTicker(getNextTick())
-	ticker2 := time.NewTicker(4 * time.Second) // time.Minute * 5)
-	go func() {                                //Handle panicks
+	ticker := clock.NewTicker(getNextTick())
+	ticker2 := clock.NewTicker(4 * time.Second) // time.Minute * 5)
+	go func() {                                 //Handle panicks
 		for {
 			select {
 			case <-done:
 				ticker.Stop()
+				ticker2.Stop()
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				rotateLog()
 				ticker.Reset(getNextTick())
-			case <-ticker2.C:
+			case <-ticker2.C():
+				reopenMut.Lock()
 				hstat, herr := humanf.Stat()
 				jstat, jerr := jsonf.Stat()
+				reopenMut.Unlock()
 				if herr != nil {
-					AddError(herr).Warning("Could not get human file stats while checking if it should be rotated")
+					DefaultDiagnostics.Report(WARNING, "could not get human file stats while checking if it should be rotated", herr)
 				}
 				if jerr != nil {
-					AddError(jerr).Warning("Could not get json file stats while checking if it should be rotated")
+					DefaultDiagnostics.Report(WARNING, "could not get json file stats while checking if it should be rotated", jerr)
 				}
 				if !(herr == nil && hstat.Size() > MB*11 || jerr == nil && jstat.Size() > MB*11) {
 					continue // Continuing if both files are smaller than 11MB
@@ -39,70 +39,70 @@ func StartRotate(done <-chan func()) {
 }
 
 func getNextTick() time.Duration {
-	now := time.Now()
+	now := clock.Now()
 	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(24*time.Hour - 5*time.Microsecond).Sub(now)
 }
 
 func rotateLog() {
-	newFilePrefix := fmt.Sprintf("%s-%s", prefix, time.Now().Format("2006.01.02"))
+	jsonFolder := folder + "/json"
+	liveHuman := fmt.Sprintf("%s/%s.log", folder, prefix)
+	liveJson := fmt.Sprintf("%s/%s.log", jsonFolder, prefix)
+	var rotatedHuman, rotatedJson string
+	reopenMut.Lock()
+	defer reopenMut.Unlock()
+	defer func() {
+		if rotatedHuman != "" {
+			hooks.Rotated(liveHuman, rotatedHuman)
+			compressor.Enqueue(folder, rotatedHuman)
+		}
+		if rotatedJson != "" {
+			hooks.Rotated(liveJson, rotatedJson)
+			compressor.Enqueue(jsonFolder, rotatedJson)
+		}
+	}()
+	defer lockFolder(folder)()
+	defer lockFolder(jsonFolder)()
+	if coordinated && reopenStale() {
+		return
+	}
+	now := clock.Now()
 	stat, err := humanf.Stat()
 	if err != nil {
-		AddError(err).Warning("Could not get human file stats while rotating logs")
+		DefaultDiagnostics.Report(WARNING, "could not get human file stats while rotating logs", err)
 	} else if stat.Size() == 0 {
-		Info("Logs did not rotate because human file size was zero 0")
+		DefaultDiagnostics.Report(INFO, "logs did not rotate because human file size was zero 0", nil)
 		return
 	}
-	err = os.Rename(fmt.Sprintf("%s/%s.log", folder, prefix), fmt.Sprintf("%s/%s.%d.log", folder, newFilePrefix, numLogfiles(folder, newFilePrefix)))
+	rotatedHuman, err = rotateTo(filesystem, liveHuman, naming, now)
 	if err != nil {
-		AddError(err).Error("Moving human readable log failed while rotating logs")
+		DefaultDiagnostics.Report(ERROR, "moving human readable log failed while rotating logs", err)
 		return
 	}
-	f, err := os.OpenFile(fmt.Sprintf("%s/%s.log", folder, prefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	f, err := OpenLogFile(filesystem, folder, prefix)
 	if err != nil {
 		return
 	}
-	human.SetOutput(f)
+	humanOut.SetFile(f)
 	humanf.Close()
 	humanf = f
 	stat, err = jsonf.Stat()
 	if err != nil {
-		AddError(err).Warning("Could not get json file stats while rotating logs")
+		DefaultDiagnostics.Report(WARNING, "could not get json file stats while rotating logs", err)
 	} else if stat.Size() == 0 {
-		Info("Json logs did not rotate because json file size was zero 0")
+		DefaultDiagnostics.Report(INFO, "json logs did not rotate because json file size was zero 0", nil)
 		return
 	}
-	jsonFolder := folder + "/json"
-	err = os.Rename(fmt.Sprintf("%s/%s.log", jsonFolder, prefix), fmt.Sprintf("%s/%s.%d.log", jsonFolder, newFilePrefix, numLogfiles(jsonFolder, newFilePrefix)))
+	rotatedJson, err = rotateTo(filesystem, liveJson, naming, now)
 	if err != nil {
-		AddError(err).Error("Moving json log failed while rotating logs")
+		DefaultDiagnostics.Report(ERROR, "moving json log failed while rotating logs", err)
 		return
 	}
-	jf, err := os.OpenFile(fmt.Sprintf("%s/%s.log", jsonFolder, prefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	jf, err := OpenLogFile(filesystem, jsonFolder, prefix)
 	if err != nil {
 		f.Close()
 		return
 	}
-	json.SetOutput(jf)
+	jsonOut.SetFile(jf)
 	jsonf.Close()
 	jsonf = jf
 }
-
-func numLogfiles(dir, prefix string) (num int) {
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return
-	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if !strings.HasSuffix(file.Name(), ".log") {
-			continue
-		}
-		if !strings.HasPrefix(file.Name(), prefix) {
-			continue
-		}
-		num++
-	}
-	return
-}
@@ -1,3 +1,5 @@
 module github.com/iidesho/bragi
 
 go 1.22
+
+require github.com/klauspost/compress v1.18.0
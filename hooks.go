@@ -0,0 +1,93 @@
+package bragi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Hooks are called as rotated segments move through their lifecycle. They are never called from
+// the goroutines that log, and no more than Concurrency of them run at the same time.
+type Hooks struct {
+	// OnRotate is called after the live file at oldPath has been moved to the segment at newPath.
+	OnRotate func(oldPath, newPath string)
+	// OnCompressed is called with the path of every compressed segment.
+	OnCompressed func(path string)
+	// OnBeforeDelete is called before retention removes the segment at path, returning false keeps it.
+	// Retention waits for the answer, so it should not take long.
+	OnBeforeDelete func(path string) bool
+	// Concurrency is how many callbacks can run at the same time, defaults to 4.
+	Concurrency int
+}
+
+// HookRunner runs Hooks in the background. A nil HookRunner does nothing and allows every deletion.
+type HookRunner struct {
+	hooks Hooks
+	sem   chan struct{}
+	wg    sync.WaitGroup
+}
+
+func NewHookRunner(h Hooks) *HookRunner {
+	if h.Concurrency <= 0 {
+		h.Concurrency = 4
+	}
+	return &HookRunner{
+		hooks: h,
+		sem:   make(chan struct{}, h.Concurrency),
+	}
+}
+
+func (r *HookRunner) call(name string, fn func()) {
+	r.sem <- struct{}{}
+	defer func() {
+		<-r.sem
+		if p := recover(); p != nil {
+			DefaultDiagnostics.Report(ERROR, "log hook panicked", fmt.Errorf("%v", p), "hook", name)
+		}
+	}()
+	fn()
+}
+
+func (r *HookRunner) async(name string, fn func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.call(name, fn)
+	}()
+}
+
+func (r *HookRunner) Rotated(oldPath, newPath string) {
+	if r == nil || r.hooks.OnRotate == nil {
+		return
+	}
+	r.async("OnRotate", func() {
+		r.hooks.OnRotate(oldPath, newPath)
+	})
+}
+
+func (r *HookRunner) Compressed(path string) {
+	if r == nil || r.hooks.OnCompressed == nil {
+		return
+	}
+	r.async("OnCompressed", func() {
+		r.hooks.OnCompressed(path)
+	})
+}
+
+// AllowDelete asks OnBeforeDelete if the segment at path can be removed. A panicking hook keeps the segment.
+func (r *HookRunner) AllowDelete(path string) (allow bool) {
+	if r == nil || r.hooks.OnBeforeDelete == nil {
+		return true
+	}
+	r.call("OnBeforeDelete", func() {
+		allow = r.hooks.OnBeforeDelete(path)
+	})
+	return
+}
+
+// Wait blocks until every callback that has been started is done.
+func (r *HookRunner) Wait() {
+	if r == nil {
+		return
+	}
+	r.wg.Wait()
+}
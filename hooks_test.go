@@ -0,0 +1,60 @@
+package bragi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	names := []string{
+		"app-" + now.Add(-3*time.Hour).Format("2006-01-02T15:04:05") + ".log",
+		"app-" + now.Add(-2*time.Hour).Format("2006-01-02T15:04:05") + ".log",
+		"app-" + now.Add(-time.Hour).Format("2006-01-02T15:04:05") + ".log",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rotated, running, peak atomic.Int32
+	r := NewHookRunner(Hooks{
+		OnRotate: func(_, _ string) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			rotated.Add(1)
+		},
+		OnBeforeDelete: func(path string) bool {
+			return !strings.HasSuffix(path, names[0])
+		},
+		Concurrency: 2,
+	})
+	for i := 0; i < 10; i++ {
+		r.Rotated("app.log", "segment")
+	}
+	removed, err := ApplyRetention(OS, dir, "app", DefaultNaming, Retention{MaxSegments: 1}, time.Now(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != filepath.Join(dir, names[1]) {
+		t.Errorf("expected only %s to be removed, got %v", names[1], removed)
+	}
+	if !FileExists(filepath.Join(dir, names[0])) {
+		t.Errorf("%s was vetoed and should have been kept", names[0])
+	}
+	r.Wait()
+	if rotated.Load() != 10 {
+		t.Errorf("expected 10 rotate hooks, got %d", rotated.Load())
+	}
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent hooks, got %d", peak.Load())
+	}
+}
@@ -0,0 +1,94 @@
+package bragi
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// FolderLock is an advisory lock on a log folder, shared by every process that rotates,
+// compresses or removes logs in it. A nil FolderLock is never locked, which is what
+// a folder owned by a single process uses.
+type FolderLock struct {
+	path string
+	f    *os.File
+	mut  sync.Mutex
+}
+
+func NewFolderLock(dir string) *FolderLock {
+	return &FolderLock{
+		path: dir + "/.bragi.lock",
+	}
+}
+
+// Lock blocks until both this process and every other process has released the folder.
+func (l *FolderLock) Lock() (err error) {
+	if l == nil {
+		return
+	}
+	l.mut.Lock()
+	if l.f == nil {
+		l.f, err = os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			l.mut.Unlock()
+			return
+		}
+	}
+	err = flock(l.f)
+	if err != nil {
+		l.mut.Unlock()
+	}
+	return
+}
+
+func (l *FolderLock) Unlock() (err error) {
+	if l == nil {
+		return
+	}
+	defer l.mut.Unlock()
+	return funlock(l.f)
+}
+
+func (l *FolderLock) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Stale reports if f no longer is the file at its path, because another process has rotated it away.
+func Stale(fsys FS, f File) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	pi, err := fsys.Stat(f.Name())
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !SameFile(fi, pi), nil
+}
+
+// ReopenIfStale opens the file now at the path of f if f has been rotated away by another process.
+// f is left open, that is up to the caller once nothing writes to it anymore.
+func ReopenIfStale(fsys FS, f File) (nf File, reopened bool, err error) {
+	stale, err := Stale(fsys, f)
+	if err != nil || !stale {
+		return f, false, err
+	}
+	nf, err = ReopenFile(fsys, f)
+	if err != nil {
+		return f, false, err
+	}
+	return nf, true, nil
+}
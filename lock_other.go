@@ -0,0 +1,15 @@
+//go:build !unix
+
+package bragi
+
+import "os"
+
+// Advisory locks are only available on unix, elsewhere a folder is only coordinated within the process.
+
+func flock(f *os.File) error {
+	return nil
+}
+
+func funlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package bragi
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogstashTimeLayout is how logstash-logback-encoder writes @timestamp, ISO 8601 with milliseconds and the offset.
+const LogstashTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// LogstashRecord is a record in the JSON layout of logstash-logback-encoder, the encoder the Java services using
+// logback write with, so their logs and the logs of Go services can share dashboards.
+type LogstashRecord struct {
+	Time       time.Time
+	Message    string
+	Logger     string
+	Thread     string
+	Level      string
+	LevelValue int
+	// Caller is the function the record was logged from, the caller fields are left out when it is empty
+	Caller string
+	File   string
+	Line   int
+	// StackTrace is left out when it is empty
+	StackTrace string
+	// MDC are the fields of the record next to the standard ones, written at the top level like logback writes its MDC
+	MDC []LogstashField
+}
+
+type LogstashField struct {
+	Key   string
+	Value any
+}
+
+// AppendLogstash appends r to buf as a line of JSON, with the fields in the order logstash-logback-encoder
+// writes them.
+func AppendLogstash(buf []byte, r LogstashRecord) []byte {
+	buf = append(buf, `{"@timestamp":`...)
+	buf = appendJSON(buf, r.Time.Format(LogstashTimeLayout))
+	buf = append(buf, `,"@version":"1","message":`...)
+	buf = appendJSON(buf, r.Message)
+	buf = append(buf, `,"logger_name":`...)
+	buf = appendJSON(buf, r.Logger)
+	buf = append(buf, `,"thread_name":`...)
+	buf = appendJSON(buf, r.Thread)
+	buf = append(buf, `,"level":`...)
+	buf = appendJSON(buf, r.Level)
+	buf = append(buf, `,"level_value":`...)
+	buf = strconv.AppendInt(buf, int64(r.LevelValue), 10)
+	if r.Caller != "" {
+		class, method := SplitFunction(r.Caller)
+		buf = append(buf, `,"caller_class_name":`...)
+		buf = appendJSON(buf, class)
+		buf = append(buf, `,"caller_method_name":`...)
+		buf = appendJSON(buf, method)
+		buf = append(buf, `,"caller_file_name":`...)
+		buf = appendJSON(buf, r.File)
+		buf = append(buf, `,"caller_line_number":`...)
+		buf = strconv.AppendInt(buf, int64(r.Line), 10)
+	}
+	if r.StackTrace != "" {
+		buf = append(buf, `,"stack_trace":`...)
+		buf = appendJSON(buf, r.StackTrace)
+	}
+	for _, f := range r.MDC {
+		buf = append(buf, ',')
+		buf = appendJSON(buf, f.Key)
+		buf = append(buf, ':')
+		buf = appendJSON(buf, f.Value)
+	}
+	return append(buf, '}', '\n')
+}
+
+func appendJSON(buf []byte, v any) []byte {
+	b, err := stdjson.Marshal(v)
+	if err != nil {
+		// A value that can not be written should not lose the rest of the record
+		b, _ = stdjson.Marshal(fmt.Sprintf("!ERROR:%v", err))
+	}
+	return append(buf, b...)
+}
+
+// SplitFunction splits a function name from runtime, like github.com/iidesho/bragi/sbragi.(*logger).log,
+// into its package github.com/iidesho/bragi/sbragi and the rest (*logger).log.
+func SplitFunction(function string) (pkg, name string) {
+	slash := strings.LastIndexByte(function, '/') + 1
+	if dot := strings.IndexByte(function[slash:], '.'); dot >= 0 {
+		return function[:slash+dot], function[slash+dot+1:]
+	}
+	return function, ""
+}
+
+// GoroutineName names the calling goroutine, like goroutine-18, for the thread_name of logstash records.
+func GoroutineName() string {
+	var buf [64]byte
+	// The stack starts with "goroutine 18 [running]:"
+	stack := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	id, _, _ := strings.Cut(stack, " ")
+	return "goroutine-" + id
+}
+
+// logbackLevel returns the name and value logback has for l, the levels logback does not have keep their names
+// and get a value between the ones of the logback levels around them.
+func (l Level) logbackLevel() (string, int) {
+	switch l {
+	case DEBUG:
+		return "DEBUG", 10000
+	case INFO:
+		return "INFO", 20000
+	case NOTICE:
+		return "NOTICE", 25000
+	case WARNING:
+		return "WARN", 30000
+	case ERROR:
+		return "ERROR", 40000
+	}
+	return l.String(), 50000
+}
@@ -0,0 +1,81 @@
+package bragi
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogstash(t *testing.T) {
+	fsys := NewMemFS()
+	fake := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.FixedZone("CET", 3600)))
+	fsys.SetClock(fake)
+	SetFS(fsys)
+	SetClock(fake)
+	defer func() {
+		folder, humanf, jsonf = "", nil, nil
+		SetFS(OS)
+		SetClock(SystemClock)
+	}()
+	closer := SetOutputFolder("/logs")
+	if closer == nil {
+		t.Fatal("expected the output folder to be set")
+	}
+	AddError(errors.New(`disk "full"`)).Error("unable to\nsave")
+	fake.BlockUntil(3)
+	closer()
+
+	human, err := fsys.ReadFile("/logs/" + prefix + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(human), "@timestamp") {
+		t.Errorf("expected no json in the human readable file, got %q", human)
+	}
+	b, err := fsys.ReadFile("/logs/json/" + prefix + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err = stdjson.Unmarshal(b, &record); err != nil {
+		t.Fatalf("expected a json record, got %q: %v", b, err)
+	}
+	for key, expected := range map[string]any{
+		"@timestamp":         "2024-01-02T03:04:05.006+01:00",
+		"@version":           "1",
+		"message":            "unable to\nsave",
+		"logger_name":        "github.com.iidesho.bragi",
+		"level":              "ERROR",
+		"level_value":        40000.0,
+		"stack_trace":        `disk "full"`,
+		"caller_class_name":  "github.com/iidesho/bragi",
+		"caller_method_name": "TestLogstash",
+		"caller_file_name":   "logstash_test.go",
+	} {
+		if record[key] != expected {
+			t.Errorf("expected %s to be %v, got %v", key, expected, record[key])
+		}
+	}
+	if !strings.HasPrefix(record["thread_name"].(string), "goroutine-") {
+		t.Errorf("expected the goroutine as thread_name, got %v", record["thread_name"])
+	}
+}
+
+func TestAppendLogstash(t *testing.T) {
+	b := AppendLogstash(nil, LogstashRecord{
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Message:    "hello",
+		Logger:     "app",
+		Thread:     "main",
+		Level:      "INFO",
+		LevelValue: 20000,
+		MDC:        []LogstashField{{Key: "user", Value: "u1"}, {Key: "attempt", Value: 2}},
+	})
+	expected := `{"@timestamp":"2024-01-02T03:04:05.000Z","@version":"1","message":"hello","logger_name":"app","thread_name":"main",` +
+		`"level":"INFO","level_value":20000,"user":"u1","attempt":2}` + "\n"
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
@@ -0,0 +1,249 @@
+package bragi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	jsonenc "encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Manifest lists the rotated segments of one log stream, so the right segment for a time window
+// can be found without opening every file.
+type Manifest struct {
+	Prefix   string        `json:"prefix"`
+	Current  string        `json:"current"`
+	Updated  time.Time     `json:"updated"`
+	Segments []SegmentInfo `json:"segments"`
+}
+
+type SegmentInfo struct {
+	// Path is relative to the folder of the manifest.
+	Path        string      `json:"path"`
+	Rotated     time.Time   `json:"rotated"`
+	First       time.Time   `json:"first,omitempty"`
+	Last        time.Time   `json:"last,omitempty"`
+	Records     int         `json:"records"`
+	Size        int64       `json:"size"`
+	Compression Compression `json:"compression"`
+}
+
+// ManifestPath returns where the manifest for prefix is kept in dir.
+func ManifestPath(dir, prefix string) string {
+	return filepath.Join(dir, prefix+".index.json")
+}
+
+// CurrentLink is the name of the symlink kept next to the live file.
+const CurrentLink = "current.log"
+
+var manifestMuts sync.Map
+
+// ReadManifest reads the manifest for prefix in dir.
+func ReadManifest(fsys FS, dir, prefix string) (m Manifest, err error) {
+	data, err := ReadFile(fsys, ManifestPath(dir, prefix))
+	if err != nil {
+		return
+	}
+	err = jsonenc.Unmarshal(data, &m)
+	return
+}
+
+// UpdateManifest brings the manifest for prefix in dir up to date with the segments on disk and
+// points the current.log symlink at the live file. Segments already in the manifest are kept as is,
+// new ones are read to find their time range, so a missing manifest is rebuilt from the segments.
+// The manifest is replaced atomically and marked as updated at now. Other processes sharing the folder have
+// to hold the folder lock.
+func UpdateManifest(fsys FS, dir, prefix string, n Naming, now time.Time) (m Manifest, err error) {
+	m, err = WriteManifest(fsys, dir, prefix, n, now)
+	linkErr := linkCurrent(fsys, dir, prefix)
+	if linkErr != nil {
+		DefaultDiagnostics.Report(WARNING, "unable to link current log file", linkErr, "dir", dir)
+	}
+	return
+}
+
+// WriteManifest brings the manifest for prefix in dir up to date like UpdateManifest, but leaves the
+// current.log symlink alone. It is for log files kept next to the main one.
+func WriteManifest(fsys FS, dir, prefix string, n Naming, now time.Time) (m Manifest, err error) {
+	mut, _ := manifestMuts.LoadOrStore(ManifestPath(dir, prefix), &sync.Mutex{})
+	mut.(*sync.Mutex).Lock()
+	defer mut.(*sync.Mutex).Unlock()
+
+	old, err := ReadManifest(fsys, dir, prefix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		DefaultDiagnostics.Report(WARNING, "unable to read log manifest, rebuilding it", err, "dir", dir)
+	}
+	known := map[string]SegmentInfo{}
+	for _, s := range old.Segments {
+		base, _ := trimCompressionExt(s.Path)
+		known[base] = s
+	}
+	segments, err := listSegments(fsys, dir, prefix, n)
+	if err != nil {
+		return
+	}
+	m = Manifest{
+		Prefix:   prefix,
+		Current:  prefix + ".log",
+		Segments: make([]SegmentInfo, 0, len(segments)),
+	}
+	// previous is where the segment before ended, the records of a segment start after it
+	var previous time.Time
+	for _, s := range segments {
+		rel := filepath.ToSlash(s.rel)
+		base, c := trimCompressionExt(rel)
+		info, ok := known[base]
+		if !ok {
+			info = SegmentInfo{
+				Rotated: s.rotated,
+			}
+			info.First, info.Last, info.Records, err = scanSegment(fsys, s.path, c)
+			if err != nil {
+				DefaultDiagnostics.Report(WARNING, "unable to read log segment for manifest", err, "path", s.path)
+			}
+			if info.Records > 0 && info.Last.IsZero() {
+				// The records have no time recordTime can read, like the ones of a pattern layout, so the
+				// segment is taken to span from the end of the one before it to when it was last written
+				info.Last = s.modified.UTC()
+				info.First = info.Last
+				if !previous.IsZero() && previous.Before(info.Last) {
+					info.First = previous
+				}
+			}
+		}
+		previous = info.Last
+		info.Path = rel
+		info.Size = s.size
+		info.Compression = c
+		m.Segments = append(m.Segments, info)
+	}
+	updated := old.Updated
+	old.Updated = time.Time{}
+	if equalManifests(old, m) {
+		m.Updated = updated
+		return m, nil
+	}
+	m.Updated = now.UTC()
+	data, err := jsonenc.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return
+	}
+	return m, writeAtomic(fsys, ManifestPath(dir, prefix), data)
+}
+
+func equalManifests(a, b Manifest) bool {
+	ad, _ := jsonenc.Marshal(a)
+	bd, _ := jsonenc.Marshal(b)
+	return bytes.Equal(ad, bd)
+}
+
+// linkCurrent points the current.log symlink at the live file, on filesystems with symlinks.
+func linkCurrent(fsys FS, dir, prefix string) error {
+	lfs, ok := fsys.(symlinkFS)
+	if !ok || prefix+".log" == CurrentLink {
+		return nil
+	}
+	link := filepath.Join(dir, CurrentLink)
+	if target, err := lfs.Readlink(link); err == nil && target == prefix+".log" {
+		return nil
+	}
+	tmp := link + ".tmp"
+	fsys.Remove(tmp)
+	err := lfs.Symlink(prefix+".log", tmp)
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, link)
+}
+
+// writeAtomic replaces the file at path with data, without readers ever seeing a partial file.
+func writeAtomic(fsys FS, path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// scanSegment counts the records in a segment and finds the time of the first and last one.
+func scanSegment(fsys FS, path string, c Compression) (first, last time.Time, records int, err error) {
+	f, err := fsys.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch c {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return first, last, 0, err
+		}
+		defer gr.Close()
+		r = gr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return first, last, 0, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), int(MB))
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		records++
+		t, ok := recordTime(s.Text())
+		if !ok {
+			continue
+		}
+		if first.IsZero() {
+			first = t
+		}
+		last = t
+	}
+	return first, last, records, s.Err()
+}
+
+// recordTime finds the timestamp of a record written by one of the bragi or sbragi handlers.
+func recordTime(line string) (time.Time, bool) {
+	var value string
+	if strings.HasPrefix(line, "{") {
+		for _, key := range []string{`"time":"`, `"@timestamp":"`} {
+			if _, rest, ok := strings.Cut(line, key); ok {
+				value, _, _ = strings.Cut(rest, `"`)
+				break
+			}
+		}
+	} else if rest, ok := strings.CutPrefix(line, "time="); ok {
+		value, _, _ = strings.Cut(rest, " ")
+	}
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, err == nil
+}
@@ -0,0 +1,93 @@
+package bragi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdateManifest(t *testing.T) {
+	dir := t.TempDir()
+	records := `{"time":"2026-10-18T10:00:00Z","msg":"first"}
+{"time":"2026-10-18T10:30:00.5Z","msg":"second"}
+{"time":"2026-10-18T11:00:00Z","msg":"third"}
+`
+	older := filepath.Join(dir, "app-2026-10-18T10:00:00.000.log")
+	newer := filepath.Join(dir, "app-2026-10-18T11:00:00.000.log")
+	for _, name := range []string{older, newer, filepath.Join(dir, "app.log")} {
+		if err := os.WriteFile(name, []byte(records), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CompressFile(OS, older, CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := UpdateManifest(OS, dir, "app", DefaultNaming, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) != 2 {
+		t.Fatalf("expected two segments, got %+v", m.Segments)
+	}
+	s := m.Segments[0]
+	if s.Path != filepath.Base(older)+".gz" || s.Compression != CompressionGzip || s.Records != 3 {
+		t.Errorf("unexpected compressed segment %+v", s)
+	}
+	if !s.First.Equal(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)) ||
+		!s.Last.Equal(time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time range %v - %v", s.First, s.Last)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, CurrentLink)); err != nil || target != "app.log" {
+		t.Errorf("current link points to %q, %v", target, err)
+	}
+
+	if err = os.Remove(newer); err != nil {
+		t.Fatal(err)
+	}
+	m, err = UpdateManifest(OS, dir, "app", DefaultNaming, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(OS, dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Segments) != 1 || read.Segments[0] != m.Segments[0] {
+		t.Errorf("manifest on disk does not match the removed segment, got %+v", read.Segments)
+	}
+}
+
+func TestManifestWithoutRecordTimes(t *testing.T) {
+	dir := t.TempDir()
+	older := filepath.Join(dir, "app-2026-10-18T10:00:00.000.log")
+	newer := filepath.Join(dir, "app-2026-10-18T11:00:00.000.log")
+	for i, name := range []string{older, newer} {
+		if err := os.WriteFile(name, []byte("10:00:00.000 INFO  g.c.i.app - written in a pattern layout\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Date(2026, 10, 18, 10+i, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(name, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	m, err := WriteManifest(OS, dir, "app", DefaultNaming, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Updated.Equal(now) {
+		t.Errorf("expected the manifest to be updated at %v, got %v", now, m.Updated)
+	}
+	if len(m.Segments) != 2 {
+		t.Fatalf("expected two segments, got %+v", m.Segments)
+	}
+	first, second := m.Segments[0], m.Segments[1]
+	if !first.First.Equal(now.Add(-2*time.Hour)) || !first.Last.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("expected the first segment at its modification time, got %v - %v", first.First, first.Last)
+	}
+	if !second.First.Equal(now.Add(-2*time.Hour)) || !second.Last.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected the second segment from the end of the first, got %v - %v", second.First, second.Last)
+	}
+}
@@ -0,0 +1,322 @@
+package bragi
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an FS kept in memory. Open files keep writing to their file after it is renamed or removed,
+// like they do on unix. Crash tests can inspect and change the files directly with ReadFile and WriteFile.
+type MemFS struct {
+	mut   sync.Mutex
+	nodes map[string]*memNode
+	// clock stamps the mod times
+	clock Clock
+}
+
+type memNode struct {
+	dir     bool
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		nodes: map[string]*memNode{
+			"/": {dir: true, mode: fs.ModeDir | 0755},
+		},
+		clock: SystemClock,
+	}
+}
+
+// SetClock sets where the mod times of the files come from, it defaults to SystemClock.
+func (m *MemFS) SetClock(c Clock) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.clock = c
+}
+
+// clean turns name into the key of its node, relative names are relative to /.
+func (m *MemFS) clean(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+func (m *MemFS) pathErr(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// parent checks that the directory name lives in exists, the filesystem has to be locked.
+func (m *MemFS) parent(op, name string) error {
+	p, ok := m.nodes[path.Dir(m.clean(name))]
+	if !ok {
+		return m.pathErr(op, name, fs.ErrNotExist)
+	}
+	if !p.dir {
+		return m.pathErr(op, name, fs.ErrInvalid)
+	}
+	return nil
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	key := m.clean(name)
+	n, ok := m.nodes[key]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, m.pathErr("open", name, fs.ErrExist)
+	case ok && n.dir && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, m.pathErr("open", name, fs.ErrInvalid)
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, m.pathErr("open", name, fs.ErrNotExist)
+	case !ok:
+		if err := m.parent("open", name); err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm, modTime: m.clock.Now()}
+		m.nodes[key] = n
+	}
+	if flag&os.O_TRUNC != 0 {
+		n.data = nil
+		n.modTime = m.clock.Now()
+	}
+	return &memFile{
+		fs:   m,
+		node: n,
+		name: name,
+		flag: flag,
+	}, nil
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	oldKey, newKey := m.clean(oldpath), m.clean(newpath)
+	n, ok := m.nodes[oldKey]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if err := m.parent("rename", newpath); err != nil {
+		return err
+	}
+	if existing, ok := m.nodes[newKey]; ok && existing.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+	}
+	delete(m.nodes, oldKey)
+	m.nodes[newKey] = n
+	if n.dir {
+		for key, child := range m.nodes {
+			if rest, ok := strings.CutPrefix(key, oldKey+"/"); ok {
+				delete(m.nodes, key)
+				m.nodes[newKey+"/"+rest] = child
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	key := m.clean(name)
+	n, ok := m.nodes[key]
+	if !ok {
+		return m.pathErr("remove", name, fs.ErrNotExist)
+	}
+	if n.dir {
+		for child := range m.nodes {
+			if strings.HasPrefix(child, key+"/") {
+				return m.pathErr("remove", name, fs.ErrExist)
+			}
+		}
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	n, ok := m.nodes[m.clean(name)]
+	if !ok {
+		return nil, m.pathErr("stat", name, fs.ErrNotExist)
+	}
+	return n.info(path.Base(m.clean(name))), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	key := m.clean(name)
+	n, ok := m.nodes[key]
+	if !ok {
+		return nil, m.pathErr("readdir", name, fs.ErrNotExist)
+	}
+	if !n.dir {
+		return nil, m.pathErr("readdir", name, fs.ErrInvalid)
+	}
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	var entries []fs.DirEntry
+	for child, cn := range m.nodes {
+		rest, ok := strings.CutPrefix(child, prefix)
+		if !ok || rest == "" || strings.Contains(rest, "/") {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(cn.info(rest)))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	key := m.clean(name)
+	var dirs []string
+	for p := key; p != "/"; p = path.Dir(p) {
+		dirs = append(dirs, p)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		n, ok := m.nodes[dirs[i]]
+		if ok && !n.dir {
+			return m.pathErr("mkdir", dirs[i], fs.ErrExist)
+		}
+		if !ok {
+			m.nodes[dirs[i]] = &memNode{dir: true, mode: fs.ModeDir | perm, modTime: m.clock.Now()}
+		}
+	}
+	return nil
+}
+
+// ReadFile returns a copy of the content of the file at name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	return ReadFile(m, name)
+}
+
+// WriteFile replaces the content of the file at name, creating it if needed.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	return memInfo{
+		name:    name,
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+		node:    n,
+	}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	node    *memNode
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.node.dir }
+func (i memInfo) Sys() any           { return i.node }
+
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, f.fs.pathErr("read", f.name, fs.ErrPermission)
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, f.fs.pathErr("write", f.name, fs.ErrPermission)
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset += int64(len(p))
+	f.node.modTime = f.fs.clock.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	if f.closed {
+		return nil, os.ErrClosed
+	}
+	return f.node.info(path.Base(f.fs.clean(f.name))), nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,83 @@
+package bragi
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenLogFile(fsys, "/logs", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte("time=2024-01-02T03:04:05Z level=INFO msg=hello\n")
+	var rotated []string
+	for i := 0; i < 3; i++ {
+		if _, err = f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+		var path string
+		f, path, err = RotateFile(fsys, f, DefaultNaming, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotated = append(rotated, path)
+		time.Sleep(time.Millisecond)
+	}
+	defer f.Close()
+	if stale, err := Stale(fsys, f); err != nil || stale {
+		t.Fatalf("new live file should not be stale, got %v, %v", stale, err)
+	}
+	data, err := fsys.ReadFile(rotated[0])
+	if err != nil || !bytes.Equal(data, line) {
+		t.Fatalf("rotated segment should hold the record, got %q, %v", data, err)
+	}
+	if err = CompressFile(fsys, rotated[0], CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := ApplyRetention(fsys, "/logs", "app", DefaultNaming, Retention{MaxSegments: 2}, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != rotated[0]+CompressionGzip.Ext() {
+		t.Fatalf("expected only the compressed segment to be removed, got %v", removed)
+	}
+	m, err := UpdateManifest(fsys, "/logs", "app", DefaultNaming, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) != 2 || m.Segments[0].Records != 1 {
+		t.Fatalf("expected two segments with one record each, got %+v", m.Segments)
+	}
+	if Exists(fsys, "/logs/"+CurrentLink) {
+		t.Error("current.log should not be linked on a filesystem without symlinks")
+	}
+}
+
+func TestMemFSClock(t *testing.T) {
+	fsys := NewMemFS()
+	fake := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	fsys.SetClock(fake)
+	if err := fsys.MkdirAll("/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/logs/app-2024-01-02T03:00:00.000.log", "/logs/app-2024-01-02T03:30:00.000.log"} {
+		if err := fsys.WriteFile(name, []byte("03:00:00.000 INFO app - no time recordTime can read\n")); err != nil {
+			t.Fatal(err)
+		}
+		fake.Advance(time.Hour)
+	}
+	m, err := WriteManifest(fsys, "/logs", "app", DefaultNaming, fake.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) != 2 || !m.Segments[0].Last.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) ||
+		!m.Segments[1].Last.Equal(time.Date(2024, 1, 2, 4, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected the segments to end at their mod times on the fake clock, got %+v", m.Segments)
+	}
+}
@@ -0,0 +1,367 @@
+package bragi
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Naming decides the names of rotated segments, relative to the folder of the live file.
+// The placeholders {prefix}, {time}, {seq}, {host} and {pid} are replaced when a segment is rotated.
+// {time} is formatted with TimeLayout and {time:layout} with the given layout, which makes date
+// sub directories possible, e.g. "{time:2006/01/02}/{prefix}-{time}.{seq}.log".
+// {seq} is zero padded to three digits and counts up from the highest sequence already used for the name,
+// so segments sort in the order they were rotated as long as the time layouts do.
+// Without {seq} the time layout has to be fine enough that two rotations never get the same name.
+type Naming struct {
+	Template   string
+	TimeLayout string
+	// Location is the time zone times are formatted in, nil means UTC.
+	Location *time.Location
+}
+
+var DefaultNaming = Naming{
+	Template:   "{prefix}-{time}.{seq}.log",
+	TimeLayout: "2006-01-02T15:04:05",
+}
+
+const (
+	partLiteral = iota
+	partPrefix
+	partTime
+	partSeq
+	partHost
+	partPid
+)
+
+type namePart struct {
+	kind  int
+	value string
+}
+
+var hostname = sync.OnceValue(func() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+})
+
+func (n Naming) parts() (parts []namePart) {
+	rest := n.Template
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		if start > 0 {
+			parts = append(parts, namePart{value: rest[:start]})
+		}
+		name, layout, _ := strings.Cut(rest[start+1:end], ":")
+		switch name {
+		case "prefix":
+			parts = append(parts, namePart{kind: partPrefix})
+		case "time":
+			if layout == "" {
+				layout = n.TimeLayout
+			}
+			parts = append(parts, namePart{kind: partTime, value: layout})
+		case "seq":
+			parts = append(parts, namePart{kind: partSeq})
+		case "host":
+			parts = append(parts, namePart{kind: partHost})
+		case "pid":
+			parts = append(parts, namePart{kind: partPid})
+		default:
+			parts = append(parts, namePart{value: rest[start : end+1]})
+		}
+		rest = rest[end+1:]
+	}
+	if rest != "" {
+		parts = append(parts, namePart{value: rest})
+	}
+	return
+}
+
+func (n Naming) location() *time.Location {
+	if n.Location == nil {
+		return time.UTC
+	}
+	return n.Location
+}
+
+func (n Naming) hasSeq() bool {
+	for _, p := range n.parts() {
+		if p.kind == partSeq {
+			return true
+		}
+	}
+	return false
+}
+
+// depth is how many directories below the folder segments are placed.
+func (n Naming) depth() int {
+	return strings.Count(n.Template, "/")
+}
+
+func (n Naming) render(prefix string, t time.Time, seq int) string {
+	t = t.In(n.location())
+	var sb strings.Builder
+	for _, p := range n.parts() {
+		switch p.kind {
+		case partPrefix:
+			sb.WriteString(prefix)
+		case partTime:
+			sb.WriteString(t.Format(p.value))
+		case partSeq:
+			fmt.Fprintf(&sb, "%03d", seq)
+		case partHost:
+			sb.WriteString(hostname())
+		case partPid:
+			sb.WriteString(strconv.Itoa(os.Getpid()))
+		default:
+			sb.WriteString(p.value)
+		}
+	}
+	return sb.String()
+}
+
+type nameMatcher struct {
+	re    *regexp.Regexp
+	parts []namePart
+}
+
+func (n Naming) matcher(prefix string) nameMatcher {
+	parts := n.parts()
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, p := range parts {
+		switch p.kind {
+		case partPrefix:
+			sb.WriteString(regexp.QuoteMeta(prefix))
+		case partTime:
+			sb.WriteString("(.+?)")
+		case partSeq:
+			sb.WriteString(`(\d+)`)
+		case partHost:
+			sb.WriteString("[^/]+?")
+		case partPid:
+			sb.WriteString(`\d+`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(filepath.ToSlash(p.value)))
+		}
+	}
+	sb.WriteString("$")
+	return nameMatcher{
+		re:    regexp.MustCompile(sb.String()),
+		parts: parts,
+	}
+}
+
+// parse returns the rotation time and sequence number of the segment at rel, relative to the folder.
+// When the template has more than one time they are parsed together, so a date directory and a clock
+// in the file name make up one time.
+func (m nameMatcher) parse(rel string, loc *time.Location) (t time.Time, seq int, ok bool) {
+	rel, _ = trimCompressionExt(filepath.ToSlash(rel))
+	match := m.re.FindStringSubmatch(rel)
+	if match == nil {
+		return
+	}
+	var layouts, values []string
+	i := 1
+	for _, p := range m.parts {
+		switch p.kind {
+		case partTime:
+			layouts = append(layouts, p.value)
+			values = append(values, match[i])
+			i++
+		case partSeq:
+			seq, _ = strconv.Atoi(match[i])
+			i++
+		}
+	}
+	if len(layouts) > 0 {
+		var err error
+		t, err = time.ParseInLocation(strings.Join(layouts, "|"), strings.Join(values, "|"), loc)
+		if err != nil {
+			return t, 0, false
+		}
+	}
+	return t, seq, true
+}
+
+// SegmentPath returns the path a segment of the live file dir/prefix.log rotated at t is moved to.
+func (n Naming) SegmentPath(fsys FS, dir, prefix string, t time.Time) (string, error) {
+	seq := 0
+	if n.hasSeq() {
+		segments, err := listSegments(fsys, dir, prefix, n)
+		if err != nil {
+			return "", err
+		}
+		for _, s := range segments {
+			rel, _ := trimCompressionExt(filepath.ToSlash(s.rel))
+			if s.seq+1 > seq && n.render(prefix, t, s.seq) == rel {
+				seq = s.seq + 1
+			}
+		}
+	}
+	return filepath.Join(dir, n.render(prefix, t, seq)), nil
+}
+
+type segment struct {
+	path    string
+	rel     string
+	rotated time.Time
+	seq     int
+	size    int64
+	// modified is when the segment was last written, or compressed
+	modified time.Time
+}
+
+// walkSegments calls fn for every file in dir that can be a segment for n, including partial files.
+func walkSegments(fsys FS, dir string, n Naming, fn func(rel string, d fs.DirEntry)) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	walkEntries(fsys, dir, "", entries, n.depth(), fn)
+	return nil
+}
+
+func walkEntries(fsys FS, dir, rel string, entries []fs.DirEntry, depth int, fn func(rel string, d fs.DirEntry)) {
+	for _, d := range entries {
+		name := filepath.Join(rel, d.Name())
+		if d.IsDir() {
+			if depth == 0 {
+				continue
+			}
+			children, err := fsys.ReadDir(filepath.Join(dir, name))
+			if err != nil {
+				continue // Most likely removed since the dir was read
+			}
+			walkEntries(fsys, dir, name, children, depth-1, fn)
+			continue
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		fn(name, d)
+	}
+}
+
+// listSegments returns every rotated segment of prefix in dir, oldest first.
+// Segments named before Naming was introduced are included as well.
+func listSegments(fsys FS, dir, prefix string, n Naming) (segments []segment, err error) {
+	m := n.matcher(prefix)
+	err = walkSegments(fsys, dir, n, func(rel string, d fs.DirEntry) {
+		t, seq, ok := m.parse(rel, n.location())
+		if !ok && !strings.ContainsRune(rel, filepath.Separator) {
+			t, seq, ok = parseLegacySegmentName(rel, prefix)
+		}
+		if !ok {
+			return
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return // Most likely removed since the dir was read
+		}
+		segments = append(segments, segment{
+			path:     filepath.Join(dir, rel),
+			rel:      rel,
+			rotated:  t,
+			seq:      seq,
+			size:     fi.Size(),
+			modified: fi.ModTime(),
+		})
+	})
+	sortSegments(segments)
+	return
+}
+
+// isSegment reports if rel, relative to dir, is a rotated segment of prefix.
+func isSegment(rel, prefix string, n Naming) bool {
+	if _, _, ok := n.matcher(prefix).parse(rel, n.location()); ok {
+		return true
+	}
+	if strings.ContainsRune(rel, filepath.Separator) {
+		return false
+	}
+	_, _, ok := parseLegacySegmentName(rel, prefix)
+	return ok
+}
+
+// parseLegacySegmentName parses the names Rotate and rotateLog wrote before Naming was introduced,
+// prefix-2006-01-02T15:04:05.log and prefix-2006.01.02.N.log.
+func parseLegacySegmentName(name, prefix string) (t time.Time, seq int, ok bool) {
+	rest, ok := strings.CutPrefix(name, prefix+"-")
+	if !ok {
+		return
+	}
+	rest, _ = trimCompressionExt(rest)
+	rest, ok = strings.CutSuffix(rest, ".log")
+	if !ok {
+		return
+	}
+	t, err := time.Parse("2006-01-02T15:04:05", rest)
+	if err == nil {
+		return t, 0, true
+	}
+	i := strings.LastIndex(rest, ".")
+	if i < 0 {
+		return t, 0, false
+	}
+	seq, err = strconv.Atoi(rest[i+1:])
+	if err != nil {
+		return t, 0, false
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006.01.02"} {
+		t, err = time.Parse(layout, rest[:i])
+		if err == nil {
+			return t, seq, true
+		}
+	}
+	return t, 0, false
+}
+
+// segmentExists reports if a segment exists at path, compressed or not.
+func segmentExists(fsys FS, path string) bool {
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		if Exists(fsys, path+c.Ext()) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEmptyDirs removes the directories between path and dir that are left empty.
+func removeEmptyDirs(fsys FS, dir, path string) {
+	for p := filepath.Dir(path); p != dir && strings.HasPrefix(p, dir); p = filepath.Dir(p) {
+		err := fsys.Remove(p)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func trimCompressionExt(name string) (string, Compression) {
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		if base, ok := strings.CutSuffix(name, c.Ext()); ok {
+			return base, c
+		}
+	}
+	return name, CompressionNone
+}
+
+var ErrSegmentExists = errors.New("rotated segment already exists")
@@ -0,0 +1,61 @@
+package bragi
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNamingSegmentPath(t *testing.T) {
+	dir := t.TempDir()
+	n := Naming{
+		Template:   "{time:2006/01/02}/{prefix}-{time}.{seq}.log",
+		TimeLayout: "15-04-05",
+	}
+	now := time.Date(2024, 10, 18, 9, 30, 0, 0, time.UTC)
+	var paths []string
+	for range 3 {
+		path, err := n.SegmentPath(OS, dir, "app", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if want := filepath.Join(dir, "2024/10/18/app-09-30-00.002.log"); paths[2] != want {
+		t.Errorf("expected %s, got %s", want, paths[2])
+	}
+	if !sort.StringsAreSorted(paths) {
+		t.Errorf("segment names does not sort in rotation order: %v", paths)
+	}
+
+	segments, err := listSegments(OS, dir, "app", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 || !segments[0].rotated.Equal(now) || segments[2].seq != 2 {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+
+	removed, err := ApplyRetention(OS, dir, "app", n, Retention{MaxSegments: 1}, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected two removed segments, got %v", removed)
+	}
+	removed, err = ApplyRetention(OS, dir, "app", n, Retention{MaxAge: time.Hour}, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || FileExists(filepath.Join(dir, "2024")) {
+		t.Errorf("expected the last segment and its empty date directories to be removed, got %v", removed)
+	}
+}
@@ -0,0 +1,21 @@
+package bragi
+
+import (
+	"os"
+)
+
+// ReopenFile opens the file now at the path of f, whether or not it still is f.
+// f is left open, that is up to the caller once nothing writes to it anymore.
+func ReopenFile(fsys FS, f File) (File, error) {
+	return fsys.OpenFile(f.Name(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// Truncated reports if f is smaller than last, as it is after an external tool like logrotate
+// with copytruncate has emptied it. size is what to compare against the next time.
+func Truncated(f File, last int64) (size int64, truncated bool, err error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return last, false, err
+	}
+	return stat.Size(), stat.Size() < last, nil
+}
@@ -0,0 +1,78 @@
+package bragi
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// Retention decides which rotated segments are kept. Zero values disable the corresponding limit.
+// Only rotated segments are counted, the live file is never removed.
+type Retention struct {
+	// MaxAge removes segments rotated longer ago than this, or last written longer ago for a Naming without a time.
+	MaxAge time.Duration
+	// MaxBytes removes the oldest segments until the rest fits within this many bytes on disk.
+	// Every segment older than the first one that does not fit is removed, even if it would fit.
+	MaxBytes int64
+	// MaxSegments removes the oldest segments until only this many are left.
+	MaxSegments int
+}
+
+// DefaultRetention keeps eleven rotated segments, which together with the live file is twelve files.
+var DefaultRetention = Retention{
+	MaxSegments: 11,
+}
+
+func sortSegments(segments []segment) {
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].rotated.Equal(segments[j].rotated) {
+			return segments[i].seq < segments[j].seq
+		}
+		return segments[i].rotated.Before(segments[j].rotated)
+	})
+}
+
+// ApplyRetention removes every rotated segment of prefix in dir that falls outside r in one pass.
+// Files not produced by rotation of prefix are never touched, and neither are segments the hooks
+// refuse to delete. The age of segments is taken at now. It returns the paths that were removed.
+func ApplyRetention(fsys FS, dir, prefix string, n Naming, r Retention, now time.Time, hooks *HookRunner) (removed []string, err error) {
+	segments, err := listSegments(fsys, dir, prefix, n)
+	if err != nil {
+		return
+	}
+	var total int64
+	var errs []error
+	kept := 0
+	// exceeded is set at the first segment outside r, every segment older than it goes as well
+	exceeded := false
+	for i := len(segments) - 1; i >= 0; i-- {
+		s := segments[i]
+		total += s.size
+		rotated := s.rotated
+		if rotated.IsZero() {
+			// Naming without a time in it, so the age is how long ago the segment was last written
+			rotated = s.modified
+		}
+		exceeded = exceeded ||
+			(r.MaxSegments > 0 && kept >= r.MaxSegments) ||
+			(r.MaxBytes > 0 && total > r.MaxBytes) ||
+			(r.MaxAge > 0 && now.Sub(rotated) > r.MaxAge)
+		if !exceeded {
+			kept++
+			continue
+		}
+		if !hooks.AllowDelete(s.path) {
+			kept++
+			continue
+		}
+		rmErr := fsys.Remove(s.path)
+		if rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			errs = append(errs, rmErr)
+			continue
+		}
+		removed = append(removed, s.path)
+		removeEmptyDirs(fsys, dir, s.path)
+	}
+	return removed, errors.Join(errs...)
+}
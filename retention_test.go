@@ -0,0 +1,134 @@
+package bragi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	names := []string{
+		"app-" + now.Add(-72*time.Hour).Format("2006-01-02T15:04:05") + ".log.gz",
+		"app-" + now.Add(-3*time.Hour).Format("2006-01-02T15:04:05") + ".log",
+		"app-" + now.Add(-2*time.Hour).Format("2006-01-02T15:04:05") + ".log.zst",
+		"app-" + now.Add(-time.Hour).Format("2006-01-02T15:04:05") + ".log",
+		"app.log",
+		"app-audit.log",
+		"notes.txt",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := ApplyRetention(OS, dir, "app", DefaultNaming, Retention{MaxAge: 48 * time.Hour, MaxSegments: 2}, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected two removed segments, got %v", removed)
+	}
+	for _, name := range names[:2] {
+		if FileExists(filepath.Join(dir, name)) {
+			t.Errorf("%s should have been removed", name)
+		}
+	}
+	for _, name := range names[2:] {
+		if !FileExists(filepath.Join(dir, name)) {
+			t.Errorf("%s should have been kept", name)
+		}
+	}
+
+	removed, err = ApplyRetention(OS, dir, "app", DefaultNaming, Retention{MaxBytes: 15}, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != filepath.Join(dir, names[2]) {
+		t.Errorf("expected only %s to be removed, got %v", names[2], removed)
+	}
+}
+
+func TestApplyRetentionRemovesOlder(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	// The segment in the middle is too large, the smaller one before it has to go as well
+	sizes := []int{5, 100, 10}
+	var names []string
+	for i, size := range sizes {
+		name := filepath.Join(dir, "app-"+now.Add(time.Duration(i-3)*time.Hour).Format("2006-01-02T15:04:05")+".log")
+		if err := os.WriteFile(name, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	removed, err := ApplyRetention(OS, dir, "app", DefaultNaming, Retention{MaxBytes: 50}, now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || FileExists(names[0]) || FileExists(names[1]) || !FileExists(names[2]) {
+		t.Errorf("expected every segment from the one too large to be removed, got %v", removed)
+	}
+}
+
+func TestApplyRetentionWithoutTime(t *testing.T) {
+	dir := t.TempDir()
+	n := Naming{Template: "{prefix}.{seq}.log"}
+	now := time.Now()
+	var paths []string
+	for i := range 2 {
+		path, err := n.SegmentPath(OS, dir, "app", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := now.Add(time.Duration(i-2) * time.Hour)
+		if err = os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	removed, err := ApplyRetention(OS, dir, "app", n, Retention{MaxAge: 90 * time.Minute}, now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != paths[0] {
+		t.Errorf("expected only the segment last written two hours ago to be removed, got %v", removed)
+	}
+}
+
+func TestTruncateTaleReportsRemoved(t *testing.T) {
+	fsys := NewMemFS()
+	var out strings.Builder
+	diagnostics := DefaultDiagnostics
+	DefaultDiagnostics = NewDiagnostics(&out)
+	SetFS(fsys)
+	SetRetention(Retention{MaxSegments: 1})
+	defer func() {
+		DefaultDiagnostics = diagnostics
+		SetFS(OS)
+		SetRetention(DefaultRetention)
+	}()
+	if err := fsys.MkdirAll("/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	old := "/logs/" + DefaultPrefix + "-" + now.Add(-2*time.Hour).Format("2006-01-02T15:04:05") + ".log"
+	for _, name := range []string{old, "/logs/" + DefaultPrefix + "-" + now.Add(-time.Hour).Format("2006-01-02T15:04:05") + ".log"} {
+		if err := fsys.WriteFile(name, []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	TruncateTale("/logs")
+	if Exists(fsys, old) {
+		t.Errorf("%s should have been removed", old)
+	}
+	if !strings.Contains(out.String(), "NOTICE removed old log segments") || !strings.Contains(out.String(), old) {
+		t.Errorf("expected the removed segment to be reported, got %q", out.String())
+	}
+}
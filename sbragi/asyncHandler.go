@@ -0,0 +1,278 @@
+package sbragi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// OverflowPolicy is what an AsyncHandler does with a record when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the record being logged.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest record in the queue to make room.
+	OverflowDropOldest
+	// OverflowBlockErrors waits for room for records at LevelError and above, and drops the rest.
+	OverflowBlockErrors
+)
+
+// AsyncHandler hands records to another handler from a single goroutine, so logging never waits for the disk
+// unless the queue is full and the policy says so. Handlers derived with WithAttrs and WithGroup share the queue.
+type AsyncHandler struct {
+	handler slog.Handler
+	q       *asyncQueue
+}
+
+type asyncEntry struct {
+	ctx     context.Context
+	handler slog.Handler
+	record  slog.Record
+}
+
+type asyncQueue struct {
+	mut      sync.Mutex
+	size     int
+	policy   OverflowPolicy
+	entries  []asyncEntry
+	head     int
+	length   int
+	queued   uint64
+	finished uint64
+	dropped  uint64
+	err      error
+	closed   bool
+	// ready wakes the worker, space is closed when an entry leaves the queue and progress when one is finished
+	ready    chan struct{}
+	space    chan struct{}
+	progress chan struct{}
+	done     chan struct{}
+}
+
+// AsyncOption configures the handler created by NewAsyncHandler.
+type AsyncOption func(q *asyncQueue)
+
+// WithQueueSize sets how many records can wait to be handled, it defaults to 1024.
+func WithQueueSize(size int) AsyncOption {
+	return func(q *asyncQueue) {
+		q.size = size
+	}
+}
+
+// WithOverflowPolicy sets what happens to records logged while the queue is full, it defaults to OverflowBlock.
+func WithOverflowPolicy(p OverflowPolicy) AsyncOption {
+	return func(q *asyncQueue) {
+		q.policy = p
+	}
+}
+
+func NewAsyncHandler(h slog.Handler, opts ...AsyncOption) *AsyncHandler {
+	q := &asyncQueue{
+		size:     1024,
+		policy:   OverflowBlock,
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}),
+		progress: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.size = max(q.size, 1)
+	q.entries = make([]asyncEntry, q.size)
+	go q.run()
+	return &AsyncHandler{
+		handler: h,
+		q:       q,
+	}
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle queues r to be handled in the background. Once the handler is closed r is handled right away instead.
+func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := asyncEntry{
+		// The caller is long gone when the record is handled, so only the values of ctx are kept
+		ctx:     context.WithoutCancel(ctx),
+		handler: h.handler,
+		record:  r.Clone(),
+	}
+	if !h.q.push(ctx, e) {
+		return h.handler.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &AsyncHandler{
+		handler: h.handler.WithAttrs(attrs),
+		q:       h.q,
+	}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &AsyncHandler{
+		handler: h.handler.WithGroup(name),
+		q:       h.q,
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (h *AsyncHandler) Dropped() uint64 {
+	h.q.mut.Lock()
+	defer h.q.mut.Unlock()
+	return h.q.dropped
+}
+
+// Flush waits until every record queued before the call has been handled and flushes the wrapped handler,
+// or gives up when ctx is done. It returns the last error from the wrapped handler since the previous Flush or Close.
+func (h *AsyncHandler) Flush(ctx context.Context) error {
+	q := h.q
+	q.mut.Lock()
+	target := q.queued
+	for q.finished < target {
+		progress := q.progress
+		q.mut.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		q.mut.Lock()
+	}
+	err := q.takeErr()
+	q.mut.Unlock()
+	return errors.Join(err, flushHandler(ctx, h.handler))
+}
+
+// Close stops queueing records, waits until the queue is drained and closes the wrapped handler,
+// or gives up when ctx is done. Records logged after Close are handed to the wrapped handler right away.
+// Calling Close more than once is safe.
+func (h *AsyncHandler) Close(ctx context.Context) error {
+	q := h.q
+	q.mut.Lock()
+	q.closed = true
+	q.mut.Unlock()
+	q.wake()
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	q.mut.Lock()
+	err := q.takeErr()
+	q.mut.Unlock()
+	return errors.Join(err, closeHandler(ctx, h.handler))
+}
+
+// push queues e following the overflow policy, it returns false if the queue is closed.
+func (q *asyncQueue) push(ctx context.Context, e asyncEntry) bool {
+	q.mut.Lock()
+	for {
+		if q.closed {
+			q.mut.Unlock()
+			return false
+		}
+		if q.length < q.size {
+			break
+		}
+		switch {
+		case q.policy == OverflowDropNewest,
+			q.policy == OverflowBlockErrors && e.record.Level < LevelError:
+			q.dropped++
+			q.mut.Unlock()
+			return true
+		case q.policy == OverflowDropOldest:
+			q.pop()
+			q.dropped++
+			q.finish()
+			continue
+		}
+		space := q.space
+		q.mut.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			q.mut.Lock()
+			q.dropped++
+			q.mut.Unlock()
+			return true
+		}
+		q.mut.Lock()
+	}
+	q.entries[(q.head+q.length)%q.size] = e
+	q.length++
+	q.queued++
+	q.mut.Unlock()
+	q.wake()
+	return true
+}
+
+// pop removes the oldest entry in the queue, the queue has to be locked.
+func (q *asyncQueue) pop() asyncEntry {
+	e := q.entries[q.head]
+	q.entries[q.head] = asyncEntry{}
+	q.head = (q.head + 1) % q.size
+	q.length--
+	close(q.space)
+	q.space = make(chan struct{})
+	return e
+}
+
+// finish counts an entry that has left the queue as done, the queue has to be locked.
+func (q *asyncQueue) finish() {
+	q.finished++
+	close(q.progress)
+	q.progress = make(chan struct{})
+}
+
+// takeErr returns and clears the last error from the wrapped handler, the queue has to be locked.
+func (q *asyncQueue) takeErr() error {
+	err := q.err
+	q.err = nil
+	return err
+}
+
+func (q *asyncQueue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	for {
+		q.mut.Lock()
+		if q.length == 0 {
+			closed := q.closed
+			q.mut.Unlock()
+			if closed {
+				return
+			}
+			<-q.ready
+			continue
+		}
+		e := q.pop()
+		q.mut.Unlock()
+		err := e.handler.Handle(e.ctx, e.record)
+		q.mut.Lock()
+		if err != nil {
+			q.err = err
+		}
+		q.finish()
+		q.mut.Unlock()
+	}
+}
@@ -0,0 +1,94 @@
+package sbragi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedHandler records the messages it handles, waiting for gate before each of them.
+type gatedHandler struct {
+	gate     chan struct{}
+	mut      sync.Mutex
+	messages []string
+}
+
+func (h *gatedHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *gatedHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *gatedHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *gatedHandler) Handle(_ context.Context, r slog.Record) error {
+	if h.gate != nil {
+		<-h.gate
+	}
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.messages = append(h.messages, r.Message)
+	return nil
+}
+
+func TestAsyncHandler(t *testing.T) {
+	for _, tc := range []struct {
+		policy   OverflowPolicy
+		expected []string
+		dropped  uint64
+	}{
+		{OverflowDropNewest, []string{"0", "1", "2"}, 3},
+		{OverflowDropOldest, []string{"0", "4", "5"}, 3},
+		{OverflowBlockErrors, []string{"0", "1", "2", "error"}, 3},
+	} {
+		inner := &gatedHandler{gate: make(chan struct{})}
+		h := NewAsyncHandler(inner, WithQueueSize(2), WithOverflowPolicy(tc.policy))
+		log := slog.New(h)
+		log.Info("0")
+		// Wait for the worker to hold the first record, so the queue is empty
+		time.Sleep(10 * time.Millisecond)
+		for _, msg := range []string{"1", "2", "3", "4", "5"} {
+			log.Info(msg)
+		}
+		if tc.policy == OverflowBlockErrors {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				close(inner.gate)
+			}()
+			log.Error("error")
+		} else {
+			close(inner.gate)
+		}
+		if err := h.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if h.Dropped() != tc.dropped {
+			t.Errorf("policy %d: expected %d dropped records, got %d", tc.policy, tc.dropped, h.Dropped())
+		}
+		if len(inner.messages) != len(tc.expected) {
+			t.Fatalf("policy %d: expected %v, got %v", tc.policy, tc.expected, inner.messages)
+		}
+		for i := range tc.expected {
+			if inner.messages[i] != tc.expected[i] {
+				t.Errorf("policy %d: expected %v, got %v", tc.policy, tc.expected, inner.messages)
+				break
+			}
+		}
+	}
+}
+
+func TestAsyncHandlerFlush(t *testing.T) {
+	inner := &gatedHandler{}
+	h := NewAsyncHandler(inner, WithQueueSize(8))
+	defer h.Close(context.Background())
+	log := slog.New(h).With("scope", "test")
+	for range 100 {
+		log.Info("blocking")
+	}
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	inner.mut.Lock()
+	defer inner.mut.Unlock()
+	if len(inner.messages) != 100 || h.Dropped() != 0 {
+		t.Errorf("expected all 100 records to be handled, got %d with %d dropped", len(inner.messages), h.Dropped())
+	}
+}
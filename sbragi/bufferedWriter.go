@@ -0,0 +1,90 @@
+package sbragi
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BufferPolicy makes the streams of a folder handler batch their writes in memory.
+type BufferPolicy struct {
+	// Size is how many bytes are buffered before they are written, it defaults to 64KB
+	Size int
+	// FlushInterval is the longest a record is kept in the buffer, it defaults to a second
+	FlushInterval time.Duration
+	// FlushLevel makes records at and above it be written and synced to disk right away, nil never does
+	FlushLevel slog.Leveler
+	// SyncInterval is how often the files are synced to disk, zero leaves it to the OS
+	SyncInterval time.Duration
+}
+
+func (p BufferPolicy) size() int {
+	if p.Size <= 0 {
+		return 64 * 1024
+	}
+	return p.Size
+}
+
+func (p BufferPolicy) flushInterval() time.Duration {
+	if p.FlushInterval <= 0 {
+		return time.Second
+	}
+	return p.FlushInterval
+}
+
+func (p BufferPolicy) flushes(level slog.Level) bool {
+	return p.FlushLevel != nil && level >= p.FlushLevel.Level()
+}
+
+// bufferedWriter batches records in memory and writes them to out in one go.
+// A nil bufferedWriter has nothing buffered.
+type bufferedWriter struct {
+	mut  sync.Mutex
+	out  io.Writer
+	buf  []byte
+	size int
+}
+
+func newBufferedWriter(out io.Writer, size int) *bufferedWriter {
+	return &bufferedWriter{
+		out:  out,
+		buf:  make([]byte, 0, size),
+		size: size,
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if len(w.buf)+len(p) > w.size {
+		err := w.flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= w.size {
+		return w.out.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// Flush writes everything buffered to out.
+func (w *bufferedWriter) Flush() error {
+	if w == nil {
+		return nil
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.flush()
+}
+
+func (w *bufferedWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.out.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
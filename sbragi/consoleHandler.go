@@ -0,0 +1,272 @@
+package sbragi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiFaint = "\x1b[90m"
+	ansiRed   = "\x1b[31m"
+)
+
+// levelColors are the ANSI colors of the levels in the console.
+var levelColors = map[slog.Level]string{
+	LevelTrace:   "\x1b[90m",
+	LevelDebug:   "\x1b[36m",
+	LevelInfo:    "\x1b[32m",
+	LevelNotice:  "\x1b[34m",
+	LevelWarning: "\x1b[33m",
+	LevelError:   "\x1b[31m",
+	LevelFatal:   "\x1b[1;97;41m",
+}
+
+// ConsoleHandler writes records for people reading them in a terminal while developing. Levels are colored,
+// the source is shortened to a path within the module, and values spanning lines, errors and structured values
+// are written indented below the record. Color is off when the output is not a terminal or NO_COLOR is set.
+type ConsoleHandler struct {
+	mut   *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	color bool
+	root  string
+	// attrs are the attributes added with WithAttrs, prefix is the groups added with WithGroup
+	attrs  []patternAttr
+	prefix string
+}
+
+// ConsoleOption configures the handler created by NewConsoleHandler.
+type ConsoleOption func(h *ConsoleHandler)
+
+// WithConsoleLevel sets the lowest level written, it defaults to LevelInfo.
+func WithConsoleLevel(level slog.Leveler) ConsoleOption {
+	return func(h *ConsoleHandler) {
+		h.level = level
+	}
+}
+
+// WithColor turns color on or off whatever the output is.
+func WithColor(color bool) ConsoleOption {
+	return func(h *ConsoleHandler) {
+		h.color = color
+	}
+}
+
+// WithModuleRoot sets the folder sources are shown relative to, it defaults to the folder
+// of the go.mod above the working directory.
+func WithModuleRoot(dir string) ConsoleOption {
+	return func(h *ConsoleHandler) {
+		h.root = filepath.Clean(dir)
+	}
+}
+
+// NewConsoleHandler returns a handler writing to w, with color if w is a terminal and NO_COLOR is not set.
+func NewConsoleHandler(w io.Writer, opts ...ConsoleOption) *ConsoleHandler {
+	h := &ConsoleHandler{
+		mut:   &sync.Mutex{},
+		w:     w,
+		level: LevelInfo,
+		color: colorSupported(w),
+		root:  moduleRoot(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// colorSupported reports if w is a terminal and NO_COLOR is not set, see https://no-color.org.
+func colorSupported(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// moduleRoot finds the folder of the go.mod the working directory is in, or the working directory without one.
+func moduleRoot() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir := wd; ; {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return wd
+		}
+		dir = parent
+	}
+}
+
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.attrs
+	if r.NumAttrs() > 0 {
+		attrs = append(make([]patternAttr, 0, len(h.attrs)+r.NumAttrs()), h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendPatternAttr(attrs, h.prefix, a)
+			return true
+		})
+	}
+	buf := make([]byte, 0, 256)
+	buf = h.paint(buf, ansiFaint, r.Time.Format("15:04:05.000"))
+	buf = append(buf, ' ')
+	buf = h.paint(buf, levelColor(r.Level), fmt.Sprintf("%-7s", LevelToString(r.Level)))
+	buf = append(buf, ' ')
+	buf = append(buf, r.Message...)
+
+	// Values that do not fit on the line are written below it
+	var blocks []byte
+	for _, a := range attrs {
+		if a.key == "scope" {
+			continue
+		}
+		if err, ok := a.value.Any().(error); ok && a.value.Kind() == slog.KindAny {
+			blocks = h.block(blocks, a.key, ansiRed, fmt.Sprintf("%+v", err))
+			continue
+		}
+		value, multiline := consoleValue(a.value)
+		if multiline {
+			blocks = h.block(blocks, a.key, "", value)
+			continue
+		}
+		buf = append(buf, ' ')
+		buf = h.paint(buf, ansiFaint, a.key+"=")
+		buf = append(buf, value...)
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		buf = append(buf, ' ')
+		buf = h.paint(buf, ansiFaint, h.source(frame.File)+":"+strconv.Itoa(frame.Line))
+	}
+	buf = append(buf, '\n')
+	buf = append(buf, blocks...)
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+// block appends the value of key below the record, indented.
+func (h *ConsoleHandler) block(buf []byte, key, color, value string) []byte {
+	buf = append(buf, "    "...)
+	buf = h.paint(buf, ansiFaint, key+":")
+	buf = append(buf, '\n')
+	for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		buf = append(buf, "      "...)
+		buf = h.paint(buf, color, line)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+func (h *ConsoleHandler) paint(buf []byte, color, s string) []byte {
+	if !h.color || color == "" {
+		return append(buf, s...)
+	}
+	buf = append(buf, color...)
+	buf = append(buf, s...)
+	return append(buf, ansiReset...)
+}
+
+// source shortens file to a path within the module root, or to its folder and name outside of it.
+func (h *ConsoleHandler) source(file string) string {
+	if h.root != "" {
+		if rel, ok := strings.CutPrefix(file, h.root+string(filepath.Separator)); ok {
+			return filepath.ToSlash(rel)
+		}
+	}
+	dir, name := filepath.Split(file)
+	return filepath.ToSlash(filepath.Join(filepath.Base(dir), name))
+}
+
+// levelColor returns the color of the closest level at or below level.
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= LevelFatal:
+		return levelColors[LevelFatal]
+	case level >= LevelError:
+		return levelColors[LevelError]
+	case level >= LevelWarning:
+		return levelColors[LevelWarning]
+	case level >= LevelNotice:
+		return levelColors[LevelNotice]
+	case level >= LevelInfo:
+		return levelColors[LevelInfo]
+	case level >= LevelDebug:
+		return levelColors[LevelDebug]
+	default:
+		return levelColors[LevelTrace]
+	}
+}
+
+// consoleValue formats v for the console, and reports if it spans more than one line.
+// Maps, slices and structs are written as indented json.
+func consoleValue(v slog.Value) (string, bool) {
+	if v.Kind() == slog.KindAny {
+		if _, ok := v.Any().(fmt.Stringer); !ok {
+			switch reflect.Indirect(reflect.ValueOf(v.Any())).Kind() {
+			case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+				if b, err := json.MarshalIndent(v.Any(), "", "  "); err == nil && len(b) > 0 && b[0] != 'n' {
+					s := string(b)
+					return s, strings.Contains(s, "\n")
+				}
+			}
+		}
+	}
+	s := v.String()
+	if strings.Contains(s, "\n") {
+		return s, true
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t") {
+		return strconv.Quote(s), false
+	}
+	return s, false
+}
+
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]patternAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendPatternAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
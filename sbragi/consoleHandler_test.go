@@ -0,0 +1,96 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewConsoleHandler(&buf, WithConsoleLevel(LevelTrace), WithModuleRoot(filepath.Dir(wd)))
+	pc, line := caller()
+	r := slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.UTC), LevelNotice, "connected", pc)
+	r.AddAttrs(
+		slog.String("host", "db.local"),
+		slog.String("query", "select 1\nfrom dual"),
+		slog.Any("error", errors.New("first\nsecond")),
+		slog.Any("tags", map[string]int{"a": 1}),
+	)
+	log := h.WithAttrs([]slog.Attr{slog.String("scope", "github.com/iidesho/bragi/sbragi"), slog.String("name", "main db")})
+	if err = log.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf(`03:04:05.006 NOTICE  connected name="main db" host=db.local sbragi/consoleHandler_test.go:%d
+    query:
+      select 1
+      from dual
+    error:
+      first
+      second
+    tags:
+      {
+        "a": 1
+      }
+`, line)
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	h = NewConsoleHandler(&buf, WithColor(true), WithModuleRoot(wd))
+	r = slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), LevelFatal, "down", pc)
+	if err = h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	expected = fmt.Sprintf("\x1b[90m03:04:05.000\x1b[0m \x1b[1;97;41mFATAL  \x1b[0m down \x1b[90mconsoleHandler_test.go:%d\x1b[0m\n", line)
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if h.Enabled(context.Background(), LevelDebug) {
+		t.Error("expected debug to be disabled by default")
+	}
+
+	for _, level := range []slog.Level{LevelTrace, LevelDebug, LevelInfo, LevelNotice, LevelWarning, LevelError, LevelFatal} {
+		if levelColor(level) != levelColors[level] {
+			t.Errorf("expected the color of %s", LevelToString(level))
+		}
+	}
+	if levelColor(LevelError+1) != levelColors[LevelError] {
+		t.Error("expected levels between the named ones to get the color of the one below")
+	}
+}
+
+func TestConsoleHandlerColor(t *testing.T) {
+	if colorSupported(&bytes.Buffer{}) {
+		t.Error("expected no color when writing to something that is not a terminal")
+	}
+	f, err := os.CreateTemp(t.TempDir(), "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if colorSupported(f) {
+		t.Error("expected no color when writing to a file")
+	}
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		if !colorSupported(tty) {
+			t.Error("expected color when writing to a terminal")
+		}
+		t.Setenv("NO_COLOR", "1")
+		if colorSupported(tty) {
+			t.Error("expected no color when NO_COLOR is set")
+		}
+	}
+}
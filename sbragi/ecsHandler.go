@@ -0,0 +1,310 @@
+package sbragi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ECSVersion is the version of the Elastic Common Schema the ECSHandler writes, the one the ecs-logging libraries use.
+const ECSVersion = "1.6.0"
+
+// ECSHandler writes records as JSON in the Elastic Common Schema, so they can be indexed by Elasticsearch
+// without an ingest pipeline. The record is mapped to the ECS fields like this
+//
+//	time               @timestamp, in UTC with milliseconds
+//	level              log.level, with the sbragi names
+//	message            message
+//	scope              log.logger, or the package of the caller without a scope
+//	source             log.origin.file.name, log.origin.file.line and log.origin.function
+//	error              error.message, error.type and error.stack_trace
+//	trace_id, span_id  trace.id and span.id, taken from the span of the context if they are not attributes
+//
+// Other attributes are written as fields of their own, with groups as objects.
+type ECSHandler struct {
+	mut   *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	// source adds log.origin, like AddSource does for the slog handlers
+	source bool
+	// attrs are the attributes added with WithAttrs, in the groups they were added in
+	attrs  []ecsAttr
+	groups []string
+}
+
+type ecsAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// NewECSHandler returns a handler writing ECS JSON to w. Only the Level and AddSource of opts are used.
+func NewECSHandler(w io.Writer, opts *slog.HandlerOptions) *ECSHandler {
+	h := &ECSHandler{
+		mut:   &sync.Mutex{},
+		w:     w,
+		level: LevelInfo,
+	}
+	if opts != nil {
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+		h.source = opts.AddSource
+	}
+	return h
+}
+
+func (h *ECSHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *ECSHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		scope, traceID, spanID string
+		err                    error
+		fields                 ecsObject
+	)
+	add := func(groups []string, a slog.Attr) {
+		a.Value = a.Value.Resolve()
+		if len(groups) == 0 && a.Value.Kind() != slog.KindGroup {
+			// The attributes the sbragi logger adds become the ECS fields they stand for
+			switch a.Key {
+			case "scope":
+				scope = a.Value.String()
+				return
+			case "trace_id":
+				traceID = a.Value.String()
+				return
+			case "span_id":
+				spanID = a.Value.String()
+				return
+			case "error":
+				// error is an object in ECS, so an error that is not an error value is taken as its message
+				if e, ok := a.Value.Any().(error); ok && a.Value.Kind() == slog.KindAny {
+					err = e
+				} else {
+					err = ecsMessage(a.Value.String())
+				}
+				return
+			}
+		}
+		fields.addAttr(groups, a)
+	}
+	for _, a := range h.attrs {
+		add(a.groups, a.attr)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(h.groups, a)
+		return true
+	})
+	if traceID == "" {
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			traceID = span.TraceID().String()
+			spanID = span.SpanID().String()
+		}
+	}
+
+	var record ecsObject
+	record.add("@timestamp", r.Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	record.add("log.level", LevelToString(r.Level))
+	record.add("message", r.Message)
+	record.add("ecs.version", ECSVersion)
+	var frame runtime.Frame
+	if r.PC != 0 {
+		frame, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+	if scope == "" && frame.Function != "" {
+		scope = funcPackage(frame.Function)
+	}
+	var logObj ecsObject
+	if scope != "" {
+		logObj.add("logger", scope)
+	}
+	if h.source && frame.File != "" {
+		origin := ecsObject{
+			{key: "file", value: &ecsObject{
+				{key: "name", value: filepath.Base(frame.File)},
+				{key: "line", value: frame.Line},
+			}},
+			{key: "function", value: frame.Function},
+		}
+		logObj.add("origin", &origin)
+	}
+	if len(logObj) > 0 {
+		record.add("log", &logObj)
+	}
+	if err != nil {
+		record.add("error", ecsError(err))
+	}
+	if traceID != "" {
+		record.add("trace", &ecsObject{{key: "id", value: traceID}})
+	}
+	if spanID != "" {
+		record.add("span", &ecsObject{{key: "id", value: spanID}})
+	}
+	record = append(record, fields...)
+
+	buf, merr := json.Marshal(&record)
+	if merr != nil {
+		return merr
+	}
+	buf = append(buf, '\n')
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, werr := h.w.Write(buf)
+	return werr
+}
+
+func (h *ECSHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]ecsAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, ecsAttr{groups: h.groups, attr: a})
+	}
+	return &h2
+}
+
+func (h *ECSHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// ecsError maps err to the ECS error fields. The type skips the errors of fmt.Errorf, as they only add context
+// to the error that tells what went wrong, and the stack trace is only there for errors that print one with %+v.
+func ecsError(err error) *ecsObject {
+	e := ecsObject{{key: "message", value: err.Error()}}
+	if _, ok := err.(ecsMessage); !ok {
+		typ := fmt.Sprintf("%T", err)
+		for inner := errors.Unwrap(err); typ == "*fmt.wrapError" && inner != nil; inner = errors.Unwrap(inner) {
+			typ = fmt.Sprintf("%T", inner)
+		}
+		e.add("type", typ)
+	}
+	if stack := fmt.Sprintf("%+v", err); stack != err.Error() {
+		e.add("stack_trace", stack)
+	}
+	return &e
+}
+
+// ecsMessage is an error that is only a message, it has no error.type.
+type ecsMessage string
+
+func (m ecsMessage) Error() string {
+	return string(m)
+}
+
+// ecsObject is a JSON object that keeps its fields in the order they were added.
+type ecsObject []ecsField
+
+type ecsField struct {
+	key   string
+	value any
+}
+
+func (o *ecsObject) add(key string, value any) {
+	*o = append(*o, ecsField{key: key, value: value})
+}
+
+// addAttr adds a in the objects of its groups, creating them as needed.
+func (o *ecsObject) addAttr(groups []string, a slog.Attr) {
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	obj := o
+	for _, g := range groups {
+		obj = obj.object(g)
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		obj.add(a.Key, jsonValue(a.Value))
+		return
+	}
+	if a.Key != "" {
+		obj = obj.object(a.Key)
+	}
+	for _, ga := range a.Value.Group() {
+		ga.Value = ga.Value.Resolve()
+		obj.addAttr(nil, ga)
+	}
+}
+
+// object returns the object field key, adding it if it is not there.
+func (o *ecsObject) object(key string) *ecsObject {
+	for _, f := range *o {
+		if obj, ok := f.value.(*ecsObject); ok && f.key == key {
+			return obj
+		}
+	}
+	obj := &ecsObject{}
+	o.add(key, obj)
+	return obj
+}
+
+func (o *ecsObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, f := range *o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, key...)
+		buf = append(buf, ':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			// A value that can not be written should not lose the rest of the record
+			value, _ = json.Marshal(fmt.Sprintf("!ERROR:%v", err))
+		}
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+// jsonValue returns v as the value to write, the way slog.JSONHandler writes it.
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		if f := v.Float64(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return f
+		}
+		return v.String()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindDuration:
+		return int64(v.Duration())
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	}
+	switch a := v.Any().(type) {
+	case slog.Level:
+		return LevelToString(a)
+	case error:
+		if _, ok := a.(json.Marshaler); !ok {
+			return a.Error()
+		}
+	}
+	return v.Any()
+}
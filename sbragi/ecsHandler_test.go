@@ -0,0 +1,122 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stackError prints a stack trace with %+v, like the errors of github.com/pkg/errors.
+type stackError struct{}
+
+func (stackError) Error() string { return "with stack" }
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	if s.Flag('+') {
+		fmt.Fprint(s, "with stack\nmain.main()\n\tmain.go:12")
+		return
+	}
+	fmt.Fprint(s, e.Error())
+}
+
+func TestECSHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewECSHandler(&buf, &slog.HandlerOptions{Level: LevelTrace, AddSource: true})
+	pc, line := caller()
+	r := slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.FixedZone("CET", 3600)), LevelNotice, "open failed", pc)
+	r.AddAttrs(
+		slog.Any("error", fmt.Errorf("reading config: %w", &fs.PathError{Op: "open", Path: "app.yaml", Err: fs.ErrNotExist})),
+		slog.String("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		slog.String("span_id", "00f067aa0ba902b7"),
+		slog.Int("attempt", 2),
+		slog.Group("user", slog.String("id", "u1")),
+	)
+	log := h.WithAttrs([]slog.Attr{
+		slog.String("scope", "github.com/iidesho/bragi/sbragi"),
+		slog.Group("http", slog.String("method", "GET")),
+	})
+	if err := log.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"@timestamp":"2024-01-02T02:04:05.006Z","log.level":"NOTICE","message":"open failed","ecs.version":"` + ECSVersion + `",` +
+		`"log":{"logger":"github.com/iidesho/bragi/sbragi","origin":{"file":{"name":"ecsHandler_test.go","line":` + fmt.Sprint(line) + `},"function":"github.com/iidesho/bragi/sbragi.TestECSHandler"}},` +
+		`"error":{"message":"reading config: open app.yaml: file does not exist","type":"*fs.PathError"},` +
+		`"trace":{"id":"4bf92f3577b34da6a3ce929d0e0e4736"},"span":{"id":"00f067aa0ba902b7"},` +
+		`"http":{"method":"GET"},"attempt":2,"user":{"id":"u1"}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+
+	buf.Reset()
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	r = slog.NewRecord(time.Now(), LevelFatal, "crashed", 0)
+	r.AddAttrs(slog.Any("error", stackError{}))
+	if err := h.Handle(trace.ContextWithSpanContext(context.Background(), span), r); err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["log.level"] != "FATAL" || record["log"] != nil {
+		t.Errorf("expected FATAL without logger or origin, got %v", record)
+	}
+	if e := record["error"].(map[string]any); e["stack_trace"] != "with stack\nmain.main()\n\tmain.go:12" || e["type"] != "sbragi.stackError" {
+		t.Errorf("expected the stack trace of the error, got %v", e)
+	}
+	if record["trace"].(map[string]any)["id"] != span.TraceID().String() || record["span"].(map[string]any)["id"] != span.SpanID().String() {
+		t.Errorf("expected the trace and span of the context, got %v", record)
+	}
+}
+
+func TestFolderECS(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewHandlerInFolder(dir, WithJSONFormat(FormatLogfmt)); err == nil {
+		t.Error("expected logfmt to be rejected as the json format")
+	}
+	h, err := NewHandlerInFolder(dir, WithJSONFormat(FormatECS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.New(&h).Warn("careful", "scope", "folder")
+	if err = h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "json", "*.log"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected one json log file, got %v %v", matches, err)
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err = json.Unmarshal(b, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["log.level"] != "WARNING" || record["message"] != "careful" || record["log"].(map[string]any)["logger"] != "folder" {
+		t.Errorf("expected the warning as ECS, got %s", b)
+	}
+}
+
+func TestECSHandlerGroups(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewECSHandler(&buf, nil)).With("scope", "groups").WithGroup("http").With("method", "GET")
+	log.Info("request", "status", 200, "error", "not an error value")
+	expected := `"log":{"logger":"groups"},"http":{"method":"GET","status":200,"error":"not an error value"}}` + "\n"
+	if got := buf.String(); len(got) < len(expected) || got[len(got)-len(expected):] != expected {
+		t.Errorf("expected the attributes after the group in it, got %s", got)
+	}
+}
@@ -2,10 +2,16 @@ package sbragi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/iidesho/bragi"
@@ -13,43 +19,324 @@ import (
 )
 
 type fileHandler struct {
-	human      slog.Handler
-	json       slog.Handler
-	ctx        context.Context
-	fileHuman  *os.File
-	fileJson   *os.File
-	cancel     context.CancelFunc
-	folder     string
-	folderJson string
-	level      slog.Level
-}
-
-func NewHandlerInFolder(path string) (h fileHandler, err error) {
+	human       slog.Handler
+	json        slog.Handler
+	ctx         context.Context
+	cancel      context.CancelFunc
+	life        *lifecycle
+	fsys        bragi.FS
+	clock       bragi.Clock
+	diagnostics *bragi.Diagnostics
+	folder      string
+	folderJson  string
+	prefix      string
+	policyHuman RotationPolicy
+	policyJson  RotationPolicy
+	compression bragi.Compression
+	compressor  *bragi.Compressor
+	retention   bragi.Retention
+	naming      bragi.Naming
+	coordinated bool
+	manifest    bool
+	hooks       *bragi.HookRunner
+	external    bool
+	buffering   *BufferPolicy
+	pattern     string
+	logfmt      bool
+	jsonFormat  Format
+	streams     []*stream
+	level       slog.Level
+
+	// routeConfigs are the routes asked for with WithRoute, routes are their handlers once opened
+	routeConfigs []Route
+	routes       []routeHandler
+}
+
+// lifecycle is shared by a fileHandler and every handler derived from it.
+type lifecycle struct {
+	// mut is held for reading while records are handled and for writing when the handler is closed
+	mut    sync.RWMutex
+	closed bool
+	// goroutines are the background goroutines the files can not be closed before
+	goroutines sync.WaitGroup
+	once       sync.Once
+	done       chan struct{}
+	err        error
+}
+
+// FolderOption configures the handler created by NewHandlerInFolder.
+type FolderOption func(h *fileHandler)
+
+// WithPrefix sets the name of the live files of the handler, it defaults to the prefix of bragi when the handler
+// is created. Handlers with different prefixes can share a folder. The prefix can not be empty or hold a path separator.
+func WithPrefix(prefix string) FolderOption {
+	return func(h *fileHandler) {
+		h.prefix = prefix
+	}
+}
+
+// WithFS sets the filesystem the folder is on, it defaults to bragi.OS.
+// Coordination locks the folder on the OS filesystem whatever fsys is.
+func WithFS(fsys bragi.FS) FolderOption {
+	return func(h *fileHandler) {
+		h.fsys = fsys
+	}
+}
+
+// WithClock sets where the handler gets the time from, for rotation schedules, timers and its own records.
+// It defaults to bragi.SystemClock.
+func WithClock(c bragi.Clock) FolderOption {
+	return func(h *fileHandler) {
+		h.clock = c
+	}
+}
+
+// WithDiagnostics sets where the handler reports its own failures, it defaults to bragi.DefaultDiagnostics.
+// They are never logged through the handler itself. Compression, manifests and hooks always report to bragi.DefaultDiagnostics.
+func WithDiagnostics(d *bragi.Diagnostics) FolderOption {
+	return func(h *fileHandler) {
+		h.diagnostics = d
+	}
+}
+
+// WithPattern lays out the human readable streams with a logback pattern, see PatternHandler.
+func WithPattern(pattern string) FolderOption {
+	return func(h *fileHandler) {
+		h.pattern = pattern
+	}
+}
+
+// WithLogfmt writes the human readable streams as logfmt, see LogfmtHandler. It can not be combined with WithPattern.
+func WithLogfmt() FolderOption {
+	return func(h *fileHandler) {
+		h.logfmt = true
+	}
+}
+
+// WithJSONFormat sets the format of the json streams, FormatJSON for the slog json, FormatECS for the
+// Elastic Common Schema or FormatLogstash for the layout of logstash-logback-encoder.
+func WithJSONFormat(f Format) FolderOption {
+	return func(h *fileHandler) {
+		h.jsonFormat = f
+	}
+}
+
+// WithRotationPolicy sets the rotation policy for both the human and json stream.
+// The limits are still evaluated for each stream on its own.
+func WithRotationPolicy(p RotationPolicy) FolderOption {
+	return func(h *fileHandler) {
+		h.policyHuman = p
+		h.policyJson = p
+	}
+}
+
+// WithHumanRotationPolicy sets the rotation policy for the human readable stream only.
+func WithHumanRotationPolicy(p RotationPolicy) FolderOption {
+	return func(h *fileHandler) {
+		h.policyHuman = p
+	}
+}
+
+// WithJSONRotationPolicy sets the rotation policy for the json stream only.
+func WithJSONRotationPolicy(p RotationPolicy) FolderOption {
+	return func(h *fileHandler) {
+		h.policyJson = p
+	}
+}
+
+// WithCompression compresses rotated segments of every stream in the background.
+func WithCompression(c bragi.Compression) FolderOption {
+	return func(h *fileHandler) {
+		h.compression = c
+	}
+}
+
+// WithRetention sets which rotated segments are kept, it is applied to each stream on its own.
+func WithRetention(r bragi.Retention) FolderOption {
+	return func(h *fileHandler) {
+		h.retention = r
+	}
+}
+
+// WithNaming sets how rotated segments of every stream are named.
+func WithNaming(n bragi.Naming) FolderOption {
+	return func(h *fileHandler) {
+		h.naming = n
+	}
+}
+
+// WithCoordination makes the folder safe to share with other processes logging with the same prefix.
+// Rotation, compression and retention is serialized with an advisory lock on each folder,
+// and the handler follows rotations done by the other processes.
+func WithCoordination() FolderOption {
+	return func(h *fileHandler) {
+		h.coordinated = true
+	}
+}
+
+// WithManifest keeps an index of the rotated segments in each folder, with the time range and number
+// of records in each of them, and a current.log symlink to the live file.
+func WithManifest() FolderOption {
+	return func(h *fileHandler) {
+		h.manifest = true
+	}
+}
+
+// WithHooks calls hooks as segments of every stream are rotated, compressed and deleted.
+func WithHooks(hooks bragi.Hooks) FolderOption {
+	return func(h *fileHandler) {
+		h.hooks = bragi.NewHookRunner(hooks)
+	}
+}
+
+// WithExternalRotation leaves rotation and retention to an external tool like logrotate.
+// The live files are reopened by path on SIGHUP or Reopen, and when they have been moved or truncated underneath the handler.
+func WithExternalRotation() FolderOption {
+	return func(h *fileHandler) {
+		h.external = true
+	}
+}
+
+// WithBuffering batches the writes of every stream in memory, so the files are written in fewer and larger writes.
+// Records at the flush level of p are written and synced right away, together with everything before them.
+func WithBuffering(p BufferPolicy) FolderOption {
+	return func(h *fileHandler) {
+		h.buffering = &p
+	}
+}
+
+func NewHandlerInFolder(path string, opts ...FolderOption) (h fileHandler, err error) {
 	path = strings.TrimSuffix(path, "/")
 	ctx, cancel := context.WithCancel(context.Background())
 	h = fileHandler{
-		folder:     path,
-		folderJson: path + "/json",
-		ctx:        ctx,
-		cancel:     cancel,
+		fsys:        bragi.OS,
+		clock:       bragi.SystemClock,
+		diagnostics: bragi.DefaultDiagnostics,
+		folder:      path,
+		folderJson:  path + "/json",
+		prefix:      bragi.Prefix(),
+		ctx:         ctx,
+		cancel:      cancel,
+		life:        &lifecycle{done: make(chan struct{})},
+		policyHuman: DefaultRotationPolicy,
+		policyJson:  DefaultRotationPolicy,
+		retention:   bragi.DefaultRetention,
+		naming:      bragi.DefaultNaming,
+		jsonFormat:  FormatJSON,
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	// pending are the files opened that no stream has taken over yet
+	var pending []bragi.File
+	defer func() {
+		if err == nil {
+			return
+		}
+		cancel()
+		h.compressor.Close()
+		for _, f := range pending {
+			if f != nil {
+				f.Close()
+			}
+		}
+		for _, s := range h.streams {
+			if s.file != nil {
+				s.file.Close()
+			}
+			s.lock.Close()
+		}
+		h.hooks.Wait()
+	}()
+	err = checkPrefix(h.prefix)
+	if err != nil {
+		return
 	}
-	if !bragi.FileExists(h.folder) {
-		err = os.MkdirAll(h.folder, 0755)
+	if h.jsonFormat != FormatJSON && h.jsonFormat != FormatECS && h.jsonFormat != FormatLogstash {
+		err = fmt.Errorf("format %d is not a json format", h.jsonFormat)
+		return
+	}
+	if h.pattern != "" {
+		if h.logfmt {
+			err = errors.New("a folder handler can not have both a pattern and logfmt")
+			return
+		}
+		_, err = parsePattern(h.pattern)
+		if err != nil {
+			return
+		}
+	}
+	if !bragi.Exists(h.fsys, h.folder) {
+		err = h.fsys.MkdirAll(h.folder, 0755)
 		if err != nil {
 			return
 		}
 	}
-	if !bragi.FileExists(h.folderJson) {
-		err = os.MkdirAll(h.folderJson, 0755)
+	if !bragi.Exists(h.fsys, h.folderJson) {
+		err = h.fsys.MkdirAll(h.folderJson, 0755)
 		if err != nil {
 			return
 		}
 	}
-	h.fileHuman, h.fileJson, err = bragi.NewLogFiles(h.folder, h.folderJson)
+	// The files are opened here rather than with bragi.NewLogFiles, so the handler shares no state with the bragi logger
+	fileHuman, err := bragi.OpenLogFile(h.fsys, h.folder, h.prefix)
 	if err != nil {
-		//bragi.AddError(err).Error("unable to create new logfiles")
 		return
 	}
+	pending = append(pending, fileHuman)
+	fileJson, err := bragi.OpenLogFile(h.fsys, h.folderJson, h.prefix)
+	if err != nil {
+		return
+	}
+	pending = append(pending, fileJson)
+	h.streams = []*stream{
+		h.newStream("human", fileHuman.Name(), h.policyHuman, h.retention),
+		h.newStream("json", fileJson.Name(), h.policyJson, h.retention),
+	}
+	routeFiles, err := h.newRouteStreams()
+	if err != nil {
+		return
+	}
+	pending = append(pending, routeFiles...)
+	pollInterval := h.policyHuman.pollInterval()
+	for _, s := range h.streams {
+		pollInterval = min(pollInterval, s.policy.pollInterval())
+	}
+	if h.compression != bragi.CompressionNone {
+		if h.coordinated {
+			// Other processes follow a rotation within a poll interval, so this leaves them plenty of time
+			h.compressor = bragi.NewCoordinatedCompressor(
+				h.fsys,
+				h.compression,
+				10*max(h.policyHuman.pollInterval(), h.policyJson.pollInterval()),
+			)
+		} else {
+			h.compressor = bragi.NewCompressor(h.fsys, h.compression)
+		}
+		streams := h.streams
+		h.compressor.SetClock(h.clock)
+		h.compressor.OnCompressed(func(dir, path string) {
+			h.hooks.Compressed(path)
+			for _, s := range streams {
+				if s.dir == dir {
+					h.updateManifest(s)
+				}
+			}
+		})
+		for _, s := range h.streams {
+			h.compressor.Recover(s.dir, s.prefix, h.naming)
+		}
+	}
+	for i, f := range pending {
+		err = h.open(h.streams[i], f)
+		if err != nil {
+			return
+		}
+		pending[i] = nil
+	}
+	for _, s := range h.streams {
+		h.updateManifest(s)
+	}
 	handlerOpt := slog.HandlerOptions{
 		AddSource: false,
 		// Set a custom level to show all log output. The default value is
@@ -60,114 +347,303 @@ func NewHandlerInFolder(path string) (h fileHandler, err error) {
 	}
 	jsonHandleOpt := handlerOpt
 	jsonHandleOpt.AddSource = true
-	h.human = slog.NewTextHandler(h.fileHuman, &handlerOpt)
-	h.json = slog.NewJSONHandler(h.fileJson, &jsonHandleOpt)
+	if h.buffering != nil {
+		for _, s := range h.streams {
+			s.buf = newBufferedWriter(s.out, h.buffering.size())
+		}
+		h.life.goroutines.Add(1)
+		go h.runBuffering(ctx)
+	}
+	// The handlers write through the failovers to the logFiles, so they live on unchanged across rotations
+	h.human = h.newTextHandler(h.streams[0].writer(), &handlerOpt)
+	h.json = h.newJSONHandler(h.streams[1].writer(), &jsonHandleOpt)
+	h.streams[0].handler = h.human
+	h.streams[1].handler = h.json
+	h.newRouteHandlers(&handlerOpt, &jsonHandleOpt)
+	if h.external {
+		h.life.goroutines.Add(1)
+		go h.followExternalRotation(ctx, pollInterval)
+		return
+	}
+	h.life.goroutines.Add(1)
 	go func() {
-		nextDay := time.Now().UTC().AddDate(0, 0, 1)
-		nextDay = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 1, time.UTC)
-		nextDayIn := nextDay.Sub(time.Now().UTC())
-		rotateTicker := time.Tick(time.Second)
-		rotateDayTicker := time.NewTicker(nextDayIn)
-		truncateTaleTicker := time.Tick(time.Second * 5)
-		firstDay := true
-		slog.Info(
-			fmt.Sprintf("all tickers for logger is created, next day is in: %v", nextDayIn),
-			"next_day_in",
-			nextDayIn,
+		defer h.life.goroutines.Done()
+		now := h.clock.Now()
+		for _, s := range h.streams {
+			s.state = newRotationState(s.policy, now)
+		}
+		rotateTicker := h.clock.NewTicker(pollInterval)
+		defer rotateTicker.Stop()
+		truncateTaleTicker := h.clock.NewTicker(time.Second * 5)
+		defer truncateTaleTicker.Stop()
+		h.diagnostics.Report(
+			bragi.INFO,
+			"all tickers for logger is created",
+			nil,
+			"next_human_rotation",
+			h.streams[0].state.next,
+			"next_json_rotation",
+			h.streams[1].state.next,
 		)
 		for {
 			select {
 			case <-ctx.Done():
-				slog.Info("logger done selected. exiting")
-				h.Cancel()
+				h.diagnostics.Report(bragi.INFO, "logger done selected. exiting", nil)
 				return
-			case <-rotateTicker:
-				//Debug("logger rotate ticker selected")
-				jsonStat, err := h.fileJson.Stat()
-				if err != nil {
-					slog.Log(
-						ctx,
-						LevelFatal,
-						"unable to get json log file stats for rotation",
-						"error",
-						err.Error(),
-					)
-					continue
-				}
-				if jsonStat.Size() < 24*bragi.MB {
-					//Debug("skipping rotate as filesize is less than 24KB base2. size is: ", jsonStat.Size(), " < ", 24*MB)
-					continue
-				}
-				h.fileHuman, h.fileJson, err = bragi.Rotate(path, h.folderJson)
-				if err != nil {
-					slog.Log(ctx, LevelFatal, "unable to rotate", "error", err.Error())
-					continue
-				}
-				h.human = slog.NewTextHandler(h.fileHuman, &handlerOpt)
-				h.json = slog.NewJSONHandler(h.fileJson, &jsonHandleOpt)
-			case <-rotateDayTicker.C:
-				Debug("logger daily rotate ticker selected")
-				if firstDay {
-					firstDay = false
-					rotateDayTicker.Reset(24 * time.Hour)
+			case now := <-rotateTicker.C():
+				for _, s := range h.streams {
+					h.rotateIfDue(s, now)
 				}
-				h.fileHuman, h.fileJson, err = bragi.Rotate(path, h.folderJson)
-				if err != nil {
-					slog.Log(ctx, LevelFatal, "unable to rotate", "error", err.Error())
-					continue
+			case <-truncateTaleTicker.C():
+				h.diagnostics.Report(bragi.DEBUG, "logger truncate ticker selected", nil)
+				for _, s := range h.streams {
+					h.applyRetention(s)
 				}
-				h.human = slog.NewTextHandler(h.fileHuman, &handlerOpt)
-				h.json = slog.NewJSONHandler(h.fileJson, &jsonHandleOpt)
-			case <-truncateTaleTicker:
-				Debug("logger truncate ticker selected")
-				bragi.TruncateTale(h.folder)
-				bragi.TruncateTale(h.folderJson)
 			}
 		}
 	}()
 	return
 }
 
+// newTextHandler returns a handler for a human readable stream, laid out by the pattern if the handler has one
+// and as logfmt with WithLogfmt.
+func (h *fileHandler) newTextHandler(w io.Writer, opt *slog.HandlerOptions) slog.Handler {
+	if h.logfmt {
+		return NewLogfmtHandler(w, opt)
+	}
+	if h.pattern == "" {
+		return slog.NewTextHandler(w, opt)
+	}
+	// The pattern has been checked by NewHandlerInFolder
+	ph, _ := NewPatternHandler(w, h.pattern, opt)
+	return ph
+}
+
+// newJSONHandler returns a handler for a json stream, in the format set with WithJSONFormat.
+func (h *fileHandler) newJSONHandler(w io.Writer, opt *slog.HandlerOptions) slog.Handler {
+	switch h.jsonFormat {
+	case FormatECS:
+		return NewECSHandler(w, opt)
+	case FormatLogstash:
+		return NewLogstashHandler(w, opt)
+	}
+	return slog.NewJSONHandler(w, opt)
+}
+
+// runBuffering flushes the buffered streams on the flush interval and syncs them on the sync interval,
+// until ctx is done.
+func (h *fileHandler) runBuffering(ctx context.Context) {
+	defer h.life.goroutines.Done()
+	flushTicker := h.clock.NewTicker(h.buffering.flushInterval())
+	defer flushTicker.Stop()
+	var syncTick <-chan time.Time
+	if h.buffering.SyncInterval > 0 {
+		syncTicker := h.clock.NewTicker(h.buffering.SyncInterval)
+		defer syncTicker.Stop()
+		syncTick = syncTicker.C()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushTicker.C():
+			for _, s := range h.streams {
+				h.flush(s)
+			}
+		case <-syncTick:
+			for _, s := range h.streams {
+				h.sync(s)
+			}
+		}
+	}
+}
+
+// Reopen makes the handler open its live files again by path, so writes go to whatever files are there now.
+func (h *fileHandler) Reopen() error {
+	var errs []error
+	for _, s := range h.streams {
+		h.flush(s)
+		err := s.file.reopen()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// followExternalRotation reopens the live files on SIGHUP and follows what an external tool does to them,
+// until ctx is done.
+func (h *fileHandler) followExternalRotation(ctx context.Context, pollInterval time.Duration) {
+	defer h.life.goroutines.Done()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := h.clock.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			err := h.Reopen()
+			if err != nil {
+				h.diagnostics.Report(bragi.ERROR, "unable to reopen log files", err)
+			}
+		case <-ticker.C():
+			for _, s := range h.streams {
+				h.followExternal(s)
+			}
+		}
+	}
+}
+
 func (h *fileHandler) Enabled(_ context.Context, level slog.Level) bool {
 	return h.level <= level
 }
 
 func (h *fileHandler) Handle(ctx context.Context, r slog.Record) (err error) {
-	ctx, _ = mergedcontext.MergeContexts(h.ctx, ctx)
-	err = h.human.Handle(ctx, r)
-	if err != nil {
-		return
+	h.life.mut.RLock()
+	defer h.life.mut.RUnlock()
+	if h.life.closed {
+		return os.ErrClosed
+	}
+	ctx, cancel := mergedcontext.MergeContexts(h.ctx, ctx)
+	defer cancel()
+	// Every stream is written even if another one fails, they can fail on their own
+	errs := []error{
+		h.handle(ctx, h.human, h.streams[0], r),
+		h.handle(ctx, h.json, h.streams[1], r),
+	}
+	for _, route := range h.routes {
+		if route.route.includes(r.Level) {
+			errs = append(errs, h.handle(ctx, route.handler, route.stream, r))
+		}
 	}
-	return h.json.Handle(ctx, r)
+	return errors.Join(errs...)
+}
+
+// Dropped returns the number of records and bytes that have not made it to the log files, as writing to them failed.
+// They were written to stderr instead.
+func (h *fileHandler) Dropped() (records, bytes int64) {
+	for _, s := range h.streams {
+		r, b := s.out.Dropped()
+		records += r
+		bytes += b
+	}
+	return
 }
 
 func (h *fileHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	h.human.WithAttrs(attrs)
-	h.json.WithAttrs(attrs)
-	return h
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.human = h.human.WithAttrs(attrs)
+	h2.json = h.json.WithAttrs(attrs)
+	h2.routes = make([]routeHandler, len(h.routes))
+	for i, r := range h.routes {
+		r.handler = r.handler.WithAttrs(attrs)
+		h2.routes[i] = r
+	}
+	return &h2
 }
 
 func (h *fileHandler) WithGroup(name string) slog.Handler {
 	if name == "" {
 		return h
 	}
-	return &fileHandler{
-		folder:     h.folder,
-		folderJson: h.folderJson,
-		fileHuman:  h.fileHuman,
-		fileJson:   h.fileJson,
-		human:      h.human.WithGroup(name),
-		json:       h.json.WithGroup(name),
-		level:      h.level,
-		ctx:        h.ctx,
-		cancel:     h.cancel,
+	h2 := *h
+	h2.human = h.human.WithGroup(name)
+	h2.json = h.json.WithGroup(name)
+	h2.routes = make([]routeHandler, len(h.routes))
+	for i, r := range h.routes {
+		r.handler = r.handler.WithGroup(name)
+		h2.routes[i] = r
 	}
+	return &h2
 }
 
+// Flush writes what the handler has buffered to its files and commits them to disk.
+func (h *fileHandler) Flush(_ context.Context) error {
+	h.life.mut.RLock()
+	defer h.life.mut.RUnlock()
+	if h.life.closed {
+		return nil
+	}
+	var errs []error
+	for _, s := range h.streams {
+		err := s.buf.Flush()
+		if err == nil {
+			err = s.file.sync()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the handler from taking more records, waits for its background goroutines, and then writes out
+// what is buffered, closes the files and waits for compression and hooks, or gives up when ctx is done.
+// Records handled after Close return os.ErrClosed. Calling Close more than once is safe.
+func (h *fileHandler) Close(ctx context.Context) error {
+	h.life.once.Do(func() {
+		h.life.mut.Lock()
+		h.life.closed = true
+		h.life.mut.Unlock()
+		h.cancel()
+		go h.shutdown()
+	})
+	select {
+	case <-h.life.done:
+		return h.life.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown closes everything the handler holds once its goroutines are done with it.
+func (h *fileHandler) shutdown() {
+	defer close(h.life.done)
+	h.life.goroutines.Wait()
+	var errs []error
+	for _, s := range h.streams {
+		err := s.buf.Flush()
+		if err == nil {
+			err = s.file.sync()
+		}
+		err = errors.Join(err, s.file.Close())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	h.compressor.Close()
+	for _, s := range h.streams {
+		errs = append(errs, s.lock.Close())
+	}
+	h.hooks.Wait()
+	h.life.err = errors.Join(errs...)
+}
+
+// Cancel closes the handler like Close, without a deadline and without reporting errors.
 func (h *fileHandler) Cancel() {
-	h.fileHuman.Close()
-	h.fileJson.Close()
-	h.cancel()
+	h.Close(context.Background())
+}
+
+// checkPrefix returns an error for a prefix that does not name a file in the folder, like bragi.SetPrefix rejects.
+func checkPrefix(prefix string) error {
+	if prefix == "" {
+		return errors.New("prefix can not be empty")
+	}
+	if strings.ContainsAny(prefix, `/\`) {
+		return fmt.Errorf("prefix %q can not hold a path separator", prefix)
+	}
+	return nil
+}
+
+// filePrefix returns the log prefix of the live log file at path.
+func filePrefix(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".log")
 }
 
 func (h *fileHandler) MakeDefault() {
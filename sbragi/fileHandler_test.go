@@ -0,0 +1,482 @@
+package sbragi
+
+import (
+	"bufio"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+func countLines(t *testing.T, dir string, json bool) (lines int, files int) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if json && (!strings.HasPrefix(s.Text(), "{") || !strings.HasSuffix(s.Text(), "}")) {
+				t.Errorf("broken json record %q", s.Text())
+			}
+			lines++
+		}
+		f.Close()
+		files++
+	}
+	return
+}
+
+func TestConcurrentRotation(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir,
+		WithRotationPolicy(RotationPolicy{MaxSize: 4 * bragi.KB, PollInterval: time.Millisecond}),
+		WithRetention(bragi.Retention{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(&h)
+	const writers, records = 8, 1000
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range records {
+				log.Info("stress", "writer", w, "record", i)
+			}
+		}()
+	}
+	wg.Wait()
+	h.Cancel()
+
+	for _, d := range []string{dir, filepath.Join(dir, "json")} {
+		lines, files := countLines(t, d, d != dir)
+		if lines != writers*records {
+			t.Errorf("expected %d records in %s, found %d", writers*records, d, lines)
+		}
+		if files < 2 {
+			t.Errorf("expected %s to have been rotated, found %d files", d, files)
+		}
+	}
+}
+
+func TestCoordinatedRotation(t *testing.T) {
+	dir := t.TempDir()
+	const handlers, records = 2, 2000
+	var wg sync.WaitGroup
+	for range handlers {
+		h, err := NewHandlerInFolder(dir,
+			WithRotationPolicy(RotationPolicy{MaxSize: 4 * bragi.KB, PollInterval: time.Millisecond}),
+			WithRetention(bragi.Retention{}),
+			WithCoordination(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Cancel()
+		log := slog.New(&h)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range records {
+				log.Info("coordinated", "record", i)
+				if i%100 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines, files := countLines(t, dir, false)
+	if lines != handlers*records {
+		t.Errorf("expected %d records, found %d", handlers*records, lines)
+	}
+	if files < 2 {
+		t.Errorf("expected the folder to have been rotated, found %d files", files)
+	}
+}
+
+func TestExternalRotation(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir,
+		WithRotationPolicy(RotationPolicy{MaxSize: 1, PollInterval: time.Millisecond}),
+		WithExternalRotation(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Cancel()
+	log := slog.New(&h)
+	for i := range 100 {
+		log.Info("before", "record", i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	live := h.streams[0].file.Name()
+	if err := os.Rename(live, live+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 50 {
+		log.Info("after", "record", i)
+	}
+
+	lines, files := countLines(t, dir, false)
+	if files != 2 || lines != 150 {
+		t.Fatalf("expected 150 records in the live file and the one rotated away, found %d in %d files", lines, files)
+	}
+	b, err := os.ReadFile(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 50 || strings.Contains(string(b), "before") {
+		t.Errorf("expected only the 50 records after reopening in %s, found %d", live, n)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir,
+		WithRoute(Route{Prefix: "errors", MinLevel: LevelWarning, Format: FormatJSON}),
+		WithRoute(Route{Prefix: "trace", MinLevel: LevelTrace, MaxLevel: LevelTrace}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Cancel()
+	log := slog.New(&h).With("scope", "routes")
+	log.Info("info")
+	log.Warn("warning")
+	log.Error("error")
+	log.Log(nil, LevelTrace, "trace")
+
+	b, err := os.ReadFile(filepath.Join(dir, "errors.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"warning"`) || !strings.Contains(lines[1], `"scope":"routes"`) {
+		t.Errorf("expected the warning and error as json in errors.log, got %q", b)
+	}
+	if bragi.FileExists(filepath.Join(dir, "trace.log")) {
+		t.Error("expected trace.log to not exist while trace is off")
+	}
+
+	h.SetLevel(LevelTrace)
+	log = slog.New(&h)
+	log.Log(nil, LevelTrace, "trace")
+	log.Debug("debug")
+	b, err = os.ReadFile(filepath.Join(dir, "trace.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "\n") != 1 || !strings.Contains(string(b), "msg=trace") {
+		t.Errorf("expected only the trace record in trace.log, got %q", b)
+	}
+}
+
+func TestReservedRoute(t *testing.T) {
+	fsys := bragi.NewMemFS()
+	prefix := strings.TrimSuffix(bragi.CurrentLink, ".log")
+	h, err := NewHandlerInFolder("/logs", WithFS(fsys), WithRoute(Route{Prefix: prefix, MinLevel: LevelError}))
+	if err == nil {
+		h.Cancel()
+		t.Fatalf("expected a route named %s to be rejected", prefix)
+	}
+}
+
+func TestBuffering(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir, WithBuffering(BufferPolicy{
+		Size:          1 << 20,
+		FlushInterval: time.Hour,
+		FlushLevel:    LevelError,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(&h)
+	live := h.streams[0].file.Name()
+	log.Info("buffered")
+	if lines, _ := countLines(t, dir, false); lines != 0 {
+		t.Errorf("expected the info record to be buffered, found %d records", lines)
+	}
+	log.Error("flushed")
+	if lines, _ := countLines(t, dir, false); lines != 2 {
+		t.Errorf("expected the error to flush both records, found %d records", lines)
+	}
+	log.Info("drained")
+	h.Cancel()
+	b, err := os.ReadFile(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "msg=drained") {
+		t.Errorf("expected the buffer to be flushed when the handler is closed, got %q", b)
+	}
+}
+
+func TestIndependentHandlers(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for _, prefix := range []string{"tenant-a", "tenant-b", "audit"} {
+		h, err := NewHandlerInFolder(dir,
+			WithPrefix(prefix),
+			WithRotationPolicy(RotationPolicy{MaxSize: 2 * bragi.KB, PollInterval: time.Millisecond}),
+			WithRetention(bragi.Retention{}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Cancel()
+		log := slog.New(&h)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				log.Info("independent", "owner", prefix, "record", i)
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]int{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if line == "" {
+				continue
+			}
+			owner := line[strings.Index(line, "owner=")+len("owner="):]
+			owner = owner[:strings.IndexByte(owner, ' ')]
+			if !strings.HasPrefix(e.Name(), owner) {
+				t.Fatalf("record of %s ended up in %s", owner, e.Name())
+			}
+			records[owner]++
+		}
+	}
+	for _, prefix := range []string{"tenant-a", "tenant-b", "audit"} {
+		if records[prefix] != 500 {
+			t.Errorf("expected 500 records for %s, found %d", prefix, records[prefix])
+		}
+	}
+	if bragi.FileExists(filepath.Join(dir, bragi.DefaultPrefix+".log")) {
+		t.Error("expected no file with the default prefix")
+	}
+}
+
+func TestHandlerPrefix(t *testing.T) {
+	bragi.SetPrefix("service")
+	defer bragi.SetPrefix(bragi.DefaultPrefix)
+	fsys := bragi.NewMemFS()
+	h, err := NewHandlerInFolder("/logs", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Cancel()
+	if !bragi.Exists(fsys, "/logs/service.log") {
+		t.Error("expected the handler to default to the prefix of bragi")
+	}
+	for _, prefix := range []string{"", "a/b", `a\b`} {
+		h, err = NewHandlerInFolder("/logs", WithFS(fsys), WithPrefix(prefix))
+		if err == nil {
+			h.Cancel()
+			t.Errorf("expected prefix %q to be rejected", prefix)
+		}
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	fsys := bragi.NewMemFS()
+	h, err := NewHandlerInFolder("/logs",
+		WithFS(fsys),
+		WithRotationPolicy(RotationPolicy{MaxSize: 2 * bragi.KB, PollInterval: time.Millisecond}),
+		WithRetention(bragi.Retention{}),
+		WithManifest(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(&h)
+	for i := range 500 {
+		log.Info("in memory", "record", i)
+		if i%50 == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	h.Cancel()
+
+	m, err := bragi.ReadManifest(fsys, "/logs", bragi.DefaultPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) == 0 {
+		t.Fatal("expected the handler to rotate in memory")
+	}
+	records := 0
+	for _, s := range m.Segments {
+		records += s.Records
+	}
+	live, err := fsys.ReadFile("/logs/" + bragi.DefaultPrefix + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records += strings.Count(string(live), "\n")
+	if records != 500 {
+		t.Errorf("expected 500 records, found %d", records)
+	}
+	if _, err = os.Stat("/logs"); err == nil {
+		t.Error("expected nothing to be written to disk")
+	}
+}
+
+func TestFakeClockRotation(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	// The night before daylight saving time starts, so the next day is only 23 hours long
+	clock := bragi.NewFakeClock(time.Date(2024, 3, 30, 23, 59, 0, 0, oslo))
+	fsys := bragi.NewMemFS()
+	fsys.SetClock(clock)
+	h, err := NewHandlerInFolder("/logs",
+		WithFS(fsys),
+		WithClock(clock),
+		WithRotationPolicy(RotationPolicy{Schedule: ScheduleDaily, Location: oslo}),
+		WithRetention(bragi.Retention{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Cancel()
+	log, _ := NewLogger(&h)
+	log = log.WithClock(clock)
+	// The rotation and retention tickers
+	clock.BlockUntil(2)
+
+	// rotated moves the clock on a poll interval at a time until the handler has rotated want segments
+	rotated := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			entries, err := fsys.ReadDir("/logs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The live file and the json folder
+			if len(entries)-2 == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d rotated segments, found %d", want, len(entries)-2)
+			}
+			clock.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	log.Info("before midnight")
+	rotated(1)
+	midnight := time.Date(2024, 3, 31, 0, 0, 0, 0, oslo)
+	if now := clock.Now(); now.Before(midnight) || now.After(midnight.Add(time.Minute)) {
+		t.Errorf("expected rotation at %s, it was at %s", midnight, now)
+	}
+
+	log.Info("after midnight")
+	clock.Set(time.Date(2024, 3, 31, 23, 59, 0, 0, oslo))
+	rotated(2)
+	midnight = time.Date(2024, 4, 1, 0, 0, 0, 0, oslo)
+	if now := clock.Now(); now.Before(midnight) || now.After(midnight.Add(time.Minute)) {
+		t.Errorf("expected rotation at %s after a 23 hour day, it was at %s", midnight, now)
+	}
+}
+
+// countingFS counts the files opened through it that have not been closed, and fails to rename files in failRename.
+type countingFS struct {
+	bragi.FS
+	open       atomic.Int64
+	failRename string
+}
+
+func (c *countingFS) OpenFile(name string, flag int, perm fs.FileMode) (bragi.File, error) {
+	f, err := c.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	c.open.Add(1)
+	return &countedFile{File: f, fs: c}, nil
+}
+
+func (c *countingFS) Rename(oldpath, newpath string) error {
+	if filepath.Dir(oldpath) == c.failRename {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrPermission}
+	}
+	return c.FS.Rename(oldpath, newpath)
+}
+
+type countedFile struct {
+	bragi.File
+	fs   *countingFS
+	once sync.Once
+}
+
+func (f *countedFile) Close() error {
+	f.once.Do(func() {
+		f.fs.open.Add(-1)
+	})
+	return f.File.Close()
+}
+
+func TestFailedStartupCleansUp(t *testing.T) {
+	mem := bragi.NewMemFS()
+	// The startup rotation of the json stream fails, after the human stream has been opened
+	fsys := &countingFS{FS: mem, failRename: "/logs/json"}
+	if err := mem.MkdirAll("/logs/json", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteFile("/logs/json/"+bragi.DefaultPrefix+".log", []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewHandlerInFolder("/logs",
+		WithFS(fsys),
+		WithRotationPolicy(RotationPolicy{OnStartup: true}),
+		WithCompression(bragi.CompressionGzip),
+		WithRoute(Route{Prefix: "errors", MinLevel: LevelError}),
+	)
+	if err == nil {
+		t.Fatal("expected the failing startup rotation to fail the handler")
+	}
+	if n := fsys.open.Load(); n != 0 {
+		t.Errorf("expected every file to be closed after the failed startup, %d are open", n)
+	}
+}
@@ -0,0 +1,176 @@
+package sbragi
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+// logFile is the live segment of a stream. slog handlers write every record with a single Write,
+// and rotation swaps the file while holding the same lock, so a record always ends up whole
+// in either the old or the new segment. A lazy logFile is not created until it is first written to.
+type logFile struct {
+	fsys   bragi.FS
+	path   string
+	file   bragi.File
+	mut    sync.Mutex
+	closed bool
+	// seen is the size of file at the last check for external truncation
+	seen int64
+}
+
+func newLogFile(fsys bragi.FS, f bragi.File) *logFile {
+	return &logFile{
+		fsys: fsys,
+		path: f.Name(),
+		file: f,
+	}
+}
+
+func newLazyLogFile(fsys bragi.FS, path string) *logFile {
+	return &logFile{
+		fsys: fsys,
+		path: path,
+	}
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		nf, err := f.fsys.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		f.file = nf
+	}
+	return f.file.Write(p)
+}
+
+func (f *logFile) Name() string {
+	return f.path
+}
+
+func (f *logFile) Size() (int64, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		return 0, nil
+	}
+	stat, err := f.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// rotate moves the live segment aside as of t and continues in a new file at the same path.
+// The old segment is closed before returning, so rotated is complete and safe to compress.
+func (f *logFile) rotate(n bragi.Naming, t time.Time) (rotated string, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return "", os.ErrClosed
+	}
+	if f.file == nil {
+		return "", nil
+	}
+	nf, rotated, err := bragi.RotateFile(f.fsys, f.file, n, t)
+	if err != nil {
+		return
+	}
+	old := f.file
+	f.file = nf
+	return rotated, old.Close()
+}
+
+// follow reopens the path of the live segment if another process has rotated it away.
+func (f *logFile) follow() (reopened bool, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return false, os.ErrClosed
+	}
+	if f.file == nil {
+		return false, nil
+	}
+	nf, reopened, err := bragi.ReopenIfStale(f.fsys, f.file)
+	if err != nil || !reopened {
+		return
+	}
+	old := f.file
+	f.file = nf
+	f.seen = 0
+	return true, old.Close()
+}
+
+// sync commits the live segment to disk.
+func (f *logFile) sync() error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// reopen opens the path of the live segment again, whatever file is there now.
+func (f *logFile) reopen() error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		return nil
+	}
+	nf, err := bragi.ReopenFile(f.fsys, f.file)
+	if err != nil {
+		return err
+	}
+	old := f.file
+	f.file = nf
+	f.seen = 0
+	return old.Close()
+}
+
+// truncated reports if the live segment has shrunk since the last time it was checked, see bragi.Truncated.
+func (f *logFile) truncated() (truncated bool, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return false, os.ErrClosed
+	}
+	if f.file == nil {
+		return false, nil
+	}
+	f.seen, truncated, err = bragi.Truncated(f.file, f.seen)
+	return
+}
+
+func (f *logFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
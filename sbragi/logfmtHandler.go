@@ -0,0 +1,195 @@
+package sbragi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtHandler writes records as strict logfmt, one line of key=value pairs per record.
+// Keys of groups are joined by dots, values are quoted and escaped only when logfmt requires it,
+// and levels have their sbragi names, like TRACE and NOTICE, rather than the DEBUG-4 of slog.
+type LogfmtHandler struct {
+	mut  *sync.Mutex
+	w    io.Writer
+	opts slog.HandlerOptions
+	// preformatted are the attributes added with WithAttrs, groups are the groups added with WithGroup
+	preformatted []byte
+	groups       []string
+}
+
+// NewLogfmtHandler returns a handler writing logfmt to w. The Level, AddSource and ReplaceAttr of opts
+// work like they do for slog.TextHandler.
+func NewLogfmtHandler(w io.Writer, opts *slog.HandlerOptions) *LogfmtHandler {
+	h := &LogfmtHandler{
+		mut: &sync.Mutex{},
+		w:   w,
+	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = LevelInfo
+	}
+	return h
+}
+
+func (h *LogfmtHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *LogfmtHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := make([]byte, 0, 256)
+	if !r.Time.IsZero() {
+		buf = h.appendAttr(buf, nil, slog.Time(slog.TimeKey, r.Time))
+	}
+	buf = h.appendAttr(buf, nil, slog.Any(slog.LevelKey, r.Level))
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		buf = h.appendAttr(buf, nil, slog.String(slog.SourceKey, frame.File+":"+strconv.Itoa(frame.Line)))
+	}
+	buf = h.appendAttr(buf, nil, slog.String(slog.MessageKey, r.Message))
+	buf = append(buf, h.preformatted...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.groups, a)
+		return true
+	})
+	if len(buf) > 0 && buf[0] == ' ' {
+		buf = buf[1:]
+	}
+	buf = append(buf, '\n')
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *LogfmtHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.preformatted = append([]byte(nil), h.preformatted...)
+	for _, a := range attrs {
+		h2.preformatted = h.appendAttr(h2.preformatted, h.groups, a)
+	}
+	return &h2
+}
+
+func (h *LogfmtHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// appendAttr appends a space and a as key=value, with the groups it is in joined into its key.
+func (h *LogfmtHandler) appendAttr(buf []byte, groups []string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			buf = h.appendAttr(buf, groups, ga)
+		}
+		return buf
+	}
+	buf = append(buf, ' ')
+	for _, g := range groups {
+		buf = appendLogfmtKey(buf, g)
+		buf = append(buf, '.')
+	}
+	buf = appendLogfmtKey(buf, a.Key)
+	buf = append(buf, '=')
+	return appendLogfmtValue(buf, logfmtString(a.Value))
+}
+
+// logfmtString returns the text of v, with levels named by LevelToString.
+func logfmtString(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		switch a := v.Any().(type) {
+		case slog.Level:
+			return LevelToString(a)
+		case error:
+			return a.Error()
+		case []byte:
+			return string(a)
+		case fmt.Stringer:
+			return a.String()
+		}
+		return fmt.Sprintf("%+v", v.Any())
+	}
+	return v.String()
+}
+
+// appendLogfmtKey appends key with the bytes logfmt does not allow in keys replaced by _.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			r = '_'
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+// appendLogfmtValue appends s, quoted and escaped if it has spaces, control characters, = or " in it.
+// An empty value is written as nothing after the =, like go-logfmt does.
+func appendLogfmtValue(buf []byte, s string) []byte {
+	if !logfmtNeedsQuote(s) {
+		return append(buf, s...)
+	}
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < ' ' || r == 0x7f:
+			buf = fmt.Appendf(buf, `\u%04x`, r)
+		default:
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return append(buf, '"')
+}
+
+func logfmtNeedsQuote(s string) bool {
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
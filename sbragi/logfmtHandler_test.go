@@ -0,0 +1,109 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+func TestLogfmtHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewLogfmtHandler(&buf, &slog.HandlerOptions{Level: LevelTrace, AddSource: true})
+	pc, line := caller()
+	r := slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.UTC), LevelTrace, "query \"users\"", pc)
+	r.AddAttrs(
+		slog.String("sql", "select *\n\tfrom users"),
+		slog.String("empty", ""),
+		slog.Any("error", errors.New("no rows")),
+		slog.Group("page", slog.Int("size", 10), slog.String("bad key", "a=b")),
+		slog.Duration("took", 1500*time.Millisecond),
+	)
+	log := h.WithAttrs([]slog.Attr{slog.String("scope", "db")}).WithGroup("req")
+	if err := log.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	file := fmt.Sprintf("%s:%d", filepath.Join(mustGetwd(t), "logfmtHandler_test.go"), line)
+	expected := `time=2024-01-02T03:04:05.006Z level=TRACE source=` + file + ` msg="query \"users\"" scope=db ` +
+		`req.sql="select *\n\tfrom users" req.empty= req.error="no rows" req.page.size=10 req.page.bad_key="a=b" req.took=1.5s` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	for level, name := range map[slog.Level]string{LevelNotice: "NOTICE", LevelFatal: "FATAL", LevelWarning: "WARNING"} {
+		buf.Reset()
+		if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, level, "", 0)); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != "level="+name+" msg=\n" {
+			t.Errorf("expected %s without time and source, got %q", name, got)
+		}
+	}
+}
+
+func TestLogfmtLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLogger(NewLogfmtHandler(&buf, &slog.HandlerOptions{Level: LevelTrace, ReplaceAttr: ReplaceAttr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Notice("started", "port", 8080)
+	got := buf.String()
+	if !strings.HasSuffix(got, " level=NOTICE msg=started port=8080\n") {
+		t.Errorf("expected the notice with its port, got %q", got)
+	}
+}
+
+func TestFolderLogfmt(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewHandlerInFolder(dir, WithLogfmt(), WithPattern(DefaultPattern)); err == nil {
+		t.Error("expected logfmt and a pattern together to be rejected")
+	}
+	h, err := NewHandlerInFolder(dir,
+		WithLogfmt(),
+		WithRoute(Route{Prefix: "errors", MinLevel: LevelError, Format: FormatLogfmt}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(&h).With("scope", "folder")
+	log.Log(context.Background(), LevelNotice, "notice")
+	log.Error("failed", "cause", "disk full")
+	if err = h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string][]string{
+		bragi.DefaultPrefix + ".log": {"level=NOTICE msg=notice scope=folder", `level=ERROR msg=failed scope=folder cause="disk full"`},
+		"errors.log":                 {`level=ERROR msg=failed scope=folder cause="disk full"`},
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("expected %d records in %s, got %q", len(expected), file, b)
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(line, expected[i]) {
+				t.Errorf("expected %q to end with %q", line, expected[i])
+			}
+		}
+	}
+}
+
+func mustGetwd(t *testing.T) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
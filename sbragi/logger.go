@@ -11,9 +11,9 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/iidesho/bragi"
 	contextkeys "github.com/iidesho/gober/contextKeys"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -68,6 +68,7 @@ type logger struct {
 	scopes    *[]scopeLevel
 	scopesMut *sync.RWMutex
 	slog      *slog.Logger
+	clock     bragi.Clock
 	errf      func() error
 	scope     string
 	level     slog.Level
@@ -81,19 +82,23 @@ func NewLogger(handler slog.Handler) (logger, error) {
 }
 
 func NewDebugLogger() (logger, error) {
-	return NewLogger(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		AddSource:   true,
-		Level:       LevelDebug,
-		ReplaceAttr: ReplaceAttr,
-	}))
+	return NewLogger(stdoutHandler(LevelDebug))
 }
 
 func NewTraceLogger() (logger, error) {
-	return NewLogger(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	return NewLogger(stdoutHandler(LevelTrace))
+}
+
+// stdoutHandler returns a ConsoleHandler when stdout is a terminal, and a plain text handler when it is not.
+func stdoutHandler(level slog.Level) slog.Handler {
+	if isTerminal(os.Stdout) {
+		return NewConsoleHandler(os.Stdout, WithConsoleLevel(level))
+	}
+	return slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource:   true,
-		Level:       LevelTrace,
+		Level:       level,
 		ReplaceAttr: ReplaceAttr,
-	}))
+	})
 }
 
 func newLogger(handler slog.Handler) (logger, error) {
@@ -101,6 +106,7 @@ func newLogger(handler slog.Handler) (logger, error) {
 	return logger{
 		handler:   handler,
 		slog:      slog.New(handler),
+		clock:     bragi.SystemClock,
 		ctx:       context.Background(), // This is just a temporaty context
 		escalate:  true,
 		scopes:    &scopes,
@@ -113,6 +119,12 @@ func (l logger) SetDefault() {
 	defaultLogger = l
 }
 
+// WithClock returns a copy of the logger that timestamps its records with c.
+func (l logger) WithClock(c bragi.Clock) logger {
+	l.clock = c
+	return l
+}
+
 func (l logger) Trace(msg string, args ...any) bool {
 	return l.log(LevelTrace, msg, args...)
 }
@@ -147,6 +159,10 @@ func (l logger) Level(lvl slog.Level, msg string, args ...any) bool {
 
 func (l logger) Fatal(msg string, args ...any) {
 	if l.log(LevelFatal, msg, args...) || !l.withError {
+		// Buffered and queued records would be lost if the panic takes the process down
+		ctx, cancel := context.WithTimeout(context.Background(), fatalFlushTimeout)
+		flushHandler(ctx, l.handler)
+		cancel()
 		panic(fmt.Sprint(msg, args))
 	}
 }
@@ -370,16 +386,14 @@ func (l logger) log(level slog.Level, msg string, args ...any) (hadError bool) {
 	}
 	if l.scope != "" {
 		// return ealy if the loggers local scope reauires a higher level than requested
-		if *l.scopes != nil {
-			l.scopesMut.RLock()
-			for _, scope := range *l.scopes {
-				if strings.HasPrefix(l.scope, scope.scope) {
-					l.level = scope.level
-					break
-				}
+		l.scopesMut.RLock()
+		for _, scope := range *l.scopes {
+			if strings.HasPrefix(l.scope, scope.scope) {
+				l.level = scope.level
+				break
 			}
-			l.scopesMut.RUnlock()
 		}
+		l.scopesMut.RUnlock()
 		if l.level > level {
 			return // false
 		}
@@ -393,7 +407,7 @@ func (l logger) log(level slog.Level, msg string, args ...any) (hadError bool) {
 	// skip [runtime.Callers, this function, this function's caller]
 	runtime.Callers(3+l.depth, pcs[:])
 	pc = pcs[0]
-	r := slog.NewRecord(time.Now(), level, msg, pc)
+	r := slog.NewRecord(l.clock.Now(), level, msg, pc)
 	r.Add(args...)
 	_ = l.handler.Handle(l.ctx, r)
 	return
@@ -218,3 +218,74 @@ func BenchmarkLoggerWHandler(b *testing.B) {
 		log.Error("bench", "number", i)
 	}
 }
+
+func BenchmarkLoggerWBufferedHandler(b *testing.B) {
+	h, err := sbragi.NewHandlerInFolder("./log", sbragi.WithBuffering(sbragi.BufferPolicy{}))
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	defer h.Cancel()
+	log, err := sbragi.NewLogger(&h)
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	for i := 0; i < b.N; i++ {
+		log.Error("bench", "number", i)
+	}
+}
+
+func BenchmarkLoggerWBufferedHandlerParallel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []sbragi.FolderOption
+	}{
+		{"unbuffered", nil},
+		{"buffered", []sbragi.FolderOption{sbragi.WithBuffering(sbragi.BufferPolicy{})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h, err := sbragi.NewHandlerInFolder("./log", bc.opts...)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			defer h.Cancel()
+			log, err := sbragi.NewLogger(&h)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					log.Error("bench", "number", i)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLoggerWBufferedHandlerSyncOnError(b *testing.B) {
+	h, err := sbragi.NewHandlerInFolder("./log", sbragi.WithBuffering(sbragi.BufferPolicy{
+		FlushLevel: sbragi.LevelError,
+	}))
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	defer h.Cancel()
+	log, err := sbragi.NewLogger(&h)
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	for i := 0; i < b.N; i++ {
+		if i%100 == 0 {
+			log.Error("bench", "number", i)
+			continue
+		}
+		log.Info("bench", "number", i)
+	}
+}
@@ -0,0 +1,136 @@
+package sbragi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/iidesho/bragi"
+)
+
+// LogstashHandler writes records as JSON in the layout of logstash-logback-encoder, so Go and Java services can
+// share dashboards. The record is mapped to its fields like this
+//
+//	time        @timestamp, with the offset of its zone
+//	message     message
+//	scope       logger_name, with dots between the path elements, or the package of the caller without a scope
+//	level       level and level_value, with the logback names and values, NOTICE and FATAL get values in line with them
+//	source      caller_class_name, caller_method_name, caller_file_name and caller_line_number
+//	error       stack_trace, as the error prints itself with %+v
+//
+// @version is always 1 and thread_name is the goroutine handling the record, which is not the one logging it
+// behind an AsyncHandler. The other attributes are the MDC, written at the top level with the keys of groups
+// joined by dots.
+type LogstashHandler struct {
+	mut    *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	source bool
+	// attrs are the attributes added with WithAttrs, prefix is the groups added with WithGroup
+	attrs  []patternAttr
+	prefix string
+}
+
+// NewLogstashHandler returns a handler writing logstash JSON to w. Only the Level and AddSource of opts are used.
+func NewLogstashHandler(w io.Writer, opts *slog.HandlerOptions) *LogstashHandler {
+	h := &LogstashHandler{
+		mut:   &sync.Mutex{},
+		w:     w,
+		level: LevelInfo,
+	}
+	if opts != nil {
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+		h.source = opts.AddSource
+	}
+	return h
+}
+
+func (h *LogstashHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *LogstashHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.attrs
+	if r.NumAttrs() > 0 {
+		attrs = append(make([]patternAttr, 0, len(h.attrs)+r.NumAttrs()), h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendPatternAttr(attrs, h.prefix, a)
+			return true
+		})
+	}
+	var frame runtime.Frame
+	if r.PC != 0 {
+		frame, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+	rec := bragi.LogstashRecord{
+		Time:       r.Time,
+		Message:    r.Message,
+		Thread:     bragi.GoroutineName(),
+		Level:      logbackLevel(r.Level),
+		LevelValue: logbackLevelValue(r.Level),
+	}
+	scope := ""
+	for _, a := range attrs {
+		switch {
+		case a.key == "scope":
+			scope = a.value.String()
+			continue
+		case a.key == "error" && rec.StackTrace == "" && a.value.Kind() == slog.KindAny:
+			if err, ok := a.value.Any().(error); ok {
+				rec.StackTrace = fmt.Sprintf("%+v", err)
+				continue
+			}
+		}
+		rec.MDC = append(rec.MDC, bragi.LogstashField{Key: a.key, Value: jsonValue(a.value)})
+	}
+	if scope == "" {
+		scope = funcPackage(frame.Function)
+	}
+	rec.Logger = abbreviateLogger(scope, -1)
+	if h.source && frame.Function != "" {
+		rec.Caller = frame.Function
+		rec.File = filepath.Base(frame.File)
+		rec.Line = frame.Line
+	}
+	buf := bragi.AppendLogstash(make([]byte, 0, 256), rec)
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *LogstashHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]patternAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendPatternAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *LogstashHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// logbackLevelValue returns the level_value logback has for level. slog has four levels between the logback ones,
+// and TRACE is the only one below DEBUG that is not spaced like that.
+func logbackLevelValue(level slog.Level) int {
+	if level == LevelTrace {
+		return 5000
+	}
+	return 20000 + 2500*int(level)
+}
@@ -0,0 +1,82 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogstashHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewLogstashHandler(&buf, &slog.HandlerOptions{Level: LevelTrace, AddSource: true})
+	pc, line := caller()
+	r := slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.UTC), LevelWarning, "slow query", pc)
+	r.AddAttrs(slog.Any("error", errors.New("timeout")), slog.Duration("took", time.Second), slog.Group("db", slog.String("name", "users")))
+	log := h.WithAttrs([]slog.Attr{slog.String("scope", "github.com/iidesho/bragi/sbragi"), slog.String("trace_id", "abc")})
+	if err := log.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a json record, got %q: %v", buf.Bytes(), err)
+	}
+	for key, expected := range map[string]any{
+		"@timestamp":         "2024-01-02T03:04:05.006Z",
+		"@version":           "1",
+		"message":            "slow query",
+		"logger_name":        "github.com.iidesho.bragi.sbragi",
+		"level":              "WARN",
+		"level_value":        30000.0,
+		"stack_trace":        "timeout",
+		"caller_class_name":  "github.com/iidesho/bragi/sbragi",
+		"caller_method_name": "TestLogstashHandler",
+		"caller_file_name":   "logstashHandler_test.go",
+		"caller_line_number": float64(line),
+		"trace_id":           "abc",
+		"took":               float64(time.Second),
+		"db.name":            "users",
+	} {
+		if record[key] != expected {
+			t.Errorf("expected %s to be %v, got %v", key, expected, record[key])
+		}
+	}
+	if len(record) != 15 || !strings.HasPrefix(record["thread_name"].(string), "goroutine-") {
+		t.Errorf("expected only the logstash fields and the MDC, got %v", record)
+	}
+
+	for level, expected := range map[slog.Level]int{LevelTrace: 5000, LevelDebug: 10000, LevelInfo: 20000, LevelNotice: 25000, LevelError: 40000, LevelFatal: 50000} {
+		if got := logbackLevelValue(level); got != expected {
+			t.Errorf("expected level_value %d for %s, got %d", expected, LevelToString(level), got)
+		}
+	}
+}
+
+func TestFolderLogstash(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir, WithJSONFormat(FormatLogstash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.New(&h).Error("failed", "scope", "folder")
+	if err = h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "json", "*.log"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected one json log file, got %v %v", matches, err)
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte(`{"@timestamp":`)) || !bytes.Contains(b, []byte(`"logger_name":"folder","thread_name":`)) {
+		t.Errorf("expected the error in the logstash layout, got %s", b)
+	}
+}
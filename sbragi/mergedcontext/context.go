@@ -16,13 +16,12 @@ func MergeContexts(ctx1, ctx2 context.Context) (ctxOut context.Context, cancel c
 	var ctx context.Context
 	ctx, cancel = context.WithCancel(context.Background())
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case done <- <-ctx1.Done():
-			case done <- <-ctx2.Done():
-			}
+		select {
+		case <-ctx.Done():
+		case <-ctx1.Done():
+			close(done)
+		case <-ctx2.Done():
+			close(done)
 		}
 	}()
 
@@ -0,0 +1,123 @@
+package sbragi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Sink is a handler of a MultiHandler and the minimum level of the records it gets.
+// A nil Level leaves it to the handler alone.
+type Sink struct {
+	Handler slog.Handler
+	Level   slog.Leveler
+}
+
+func (s Sink) enabled(ctx context.Context, level slog.Level) bool {
+	if s.Level != nil && level < s.Level.Level() {
+		return false
+	}
+	return s.Handler.Enabled(ctx, level)
+}
+
+// MultiHandler fans records out to any number of sinks. The sinks fail on their own,
+// a sink that returns an error or panics does not stop the others from getting the record.
+type MultiHandler struct {
+	sinks []Sink
+}
+
+func NewMultiHandler(sinks ...Sink) *MultiHandler {
+	return &MultiHandler{
+		sinks: sinks,
+	}
+}
+
+func (h *MultiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, s := range h.sinks {
+		if s.enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle hands r to every sink that is enabled for its level, and returns the failures of all of them joined.
+func (h *MultiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for i, s := range h.sinks {
+		if !s.enabled(ctx, r.Level) {
+			continue
+		}
+		err := handleSink(ctx, s.Handler, r.Clone())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func handleSink(ctx context.Context, h slog.Handler, r slog.Record) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h.Handle(ctx, r)
+}
+
+func (h *MultiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	sinks := make([]Sink, len(h.sinks))
+	for i, s := range h.sinks {
+		sinks[i] = Sink{
+			Handler: s.Handler.WithAttrs(attrs),
+			Level:   s.Level,
+		}
+	}
+	return &MultiHandler{
+		sinks: sinks,
+	}
+}
+
+func (h *MultiHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	sinks := make([]Sink, len(h.sinks))
+	for i, s := range h.sinks {
+		sinks[i] = Sink{
+			Handler: s.Handler.WithGroup(name),
+			Level:   s.Level,
+		}
+	}
+	return &MultiHandler{
+		sinks: sinks,
+	}
+}
+
+// Flush flushes every sink that can be flushed, and returns the failures of all of them joined.
+func (h *MultiHandler) Flush(ctx context.Context) error {
+	var errs []error
+	for i, s := range h.sinks {
+		err := flushHandler(ctx, s.Handler)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink that can be closed, and returns the failures of all of them joined.
+func (h *MultiHandler) Close(ctx context.Context) error {
+	var errs []error
+	for i, s := range h.sinks {
+		err := closeHandler(ctx, s.Handler)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
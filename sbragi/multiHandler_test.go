@@ -0,0 +1,53 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingHandler struct {
+	calls int
+}
+
+func (h *failingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *failingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *failingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *failingHandler) Handle(context.Context, slog.Record) error {
+	h.calls++
+	return errors.New("network is unreachable")
+}
+
+func TestMultiHandler(t *testing.T) {
+	var stdout, file bytes.Buffer
+	network := &failingHandler{}
+	h := NewMultiHandler(
+		Sink{Handler: slog.NewTextHandler(&stdout, &slog.HandlerOptions{Level: LevelTrace}), Level: LevelInfo},
+		Sink{Handler: network, Level: LevelError},
+		Sink{Handler: slog.NewTextHandler(&file, &slog.HandlerOptions{Level: LevelTrace}), Level: LevelDebug},
+	)
+	log := slog.New(h).With("scope", "test").WithGroup("req")
+	if h.Enabled(context.Background(), LevelTrace) {
+		t.Error("expected no sink to be enabled for trace")
+	}
+	log.Debug("debug", "id", 1)
+	log.Info("info", "id", 2)
+	if network.calls != 0 {
+		t.Errorf("expected the network sink to only get errors, it got %d records", network.calls)
+	}
+	err := h.WithAttrs([]slog.Attr{slog.String("scope", "test")}).Handle(context.Background(), slog.NewRecord(time.Now(), LevelError, "error", 0))
+	if err == nil || !strings.Contains(err.Error(), "sink 1: network is unreachable") {
+		t.Errorf("expected the network failure to be returned, got %v", err)
+	}
+	if strings.Contains(stdout.String(), "msg=debug") || !strings.Contains(stdout.String(), "msg=info scope=test req.id=2") {
+		t.Errorf("expected stdout to only have the info record with its attrs, got %q", stdout.String())
+	}
+	if !strings.Contains(file.String(), "msg=debug scope=test req.id=1") || !strings.Contains(file.String(), "msg=error scope=test") {
+		t.Errorf("expected the file to have every record even though the network sink failed, got %q", file.String())
+	}
+}
@@ -0,0 +1,366 @@
+package sbragi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type patternKind int
+
+const (
+	patternLiteral patternKind = iota
+	patternDate
+	patternLevel
+	patternLogger
+	patternFile
+	patternLine
+	patternMessage
+	patternKV
+	patternException
+)
+
+// patternWords are the logback conversion words that are supported, with their aliases.
+var patternWords = map[string]patternKind{
+	"d":         patternDate,
+	"date":      patternDate,
+	"p":         patternLevel,
+	"le":        patternLevel,
+	"level":     patternLevel,
+	"c":         patternLogger,
+	"lo":        patternLogger,
+	"logger":    patternLogger,
+	"F":         patternFile,
+	"file":      patternFile,
+	"L":         patternLine,
+	"line":      patternLine,
+	"m":         patternMessage,
+	"msg":       patternMessage,
+	"message":   patternMessage,
+	"kv":        patternKV,
+	"kvp":       patternKV,
+	"ex":        patternException,
+	"exception": patternException,
+	"throwable": patternException,
+}
+
+// patternPart is one literal or conversion of a pattern, with the logback format modifiers of the conversion.
+type patternPart struct {
+	kind    patternKind
+	literal string
+	// min pads the conversion to at least this width, on the left unless left is set
+	min  int
+	left bool
+	// max truncates the conversion to at most this width, from the start unless truncateEnd is set
+	max         int
+	truncateEnd bool
+	// length is the length the logger is abbreviated to, -1 leaves it as is
+	length int
+	date   *dateLayout
+}
+
+// parsePattern splits a logback pattern like "%d{HH:mm:ss.SSS} %-5level %logger{36} - %msg%n" into its parts.
+func parsePattern(pattern string) (parts []patternPart, err error) {
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, patternPart{kind: patternLiteral, literal: literal.String()})
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' && i+1 < len(pattern) {
+			i++
+			literal.WriteByte(pattern[i])
+			continue
+		}
+		if c != '%' {
+			literal.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(pattern) {
+			return nil, fmt.Errorf("pattern ends with a lone %%")
+		}
+		if pattern[i] == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+		p := patternPart{length: -1}
+		i, err = p.parseModifiers(pattern, i)
+		if err != nil {
+			return nil, err
+		}
+		start := i
+		for i < len(pattern) && isWordByte(pattern[i]) {
+			i++
+		}
+		word := pattern[start:i]
+		var opts []string
+		for i < len(pattern) && pattern[i] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed option of %%%s in pattern", word)
+			}
+			opts = append(opts, pattern[i+1:i+end])
+			i += end + 1
+		}
+		i--
+		if word == "n" {
+			literal.WriteByte('\n')
+			continue
+		}
+		kind, ok := patternWords[word]
+		if !ok {
+			return nil, fmt.Errorf("unknown conversion word %q in pattern", word)
+		}
+		p.kind = kind
+		err = p.parseOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		flush()
+		parts = append(parts, p)
+	}
+	flush()
+	return parts, nil
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseModifiers reads the format modifiers starting at i, like -5 or .-10, and returns where the word starts.
+func (p *patternPart) parseModifiers(pattern string, i int) (int, error) {
+	if pattern[i] == '-' {
+		p.left = true
+		i++
+	}
+	start := i
+	for i < len(pattern) && pattern[i] >= '0' && pattern[i] <= '9' {
+		i++
+	}
+	if i > start {
+		p.min, _ = strconv.Atoi(pattern[start:i])
+	}
+	if i < len(pattern) && pattern[i] == '.' {
+		i++
+		if i < len(pattern) && pattern[i] == '-' {
+			p.truncateEnd = true
+			i++
+		}
+		start = i
+		for i < len(pattern) && pattern[i] >= '0' && pattern[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return i, fmt.Errorf("missing max width after . in pattern")
+		}
+		p.max, _ = strconv.Atoi(pattern[start:i])
+	}
+	return i, nil
+}
+
+func (p *patternPart) parseOptions(opts []string) (err error) {
+	switch p.kind {
+	case patternDate:
+		layout, zone := "", ""
+		if len(opts) > 0 {
+			layout, zone, _ = strings.Cut(opts[0], ",")
+		}
+		p.date, err = parseDateLayout(strings.TrimSpace(layout), strings.TrimSpace(zone))
+	case patternLogger:
+		if len(opts) > 0 {
+			p.length, err = strconv.Atoi(strings.TrimSpace(opts[0]))
+			if err != nil {
+				return fmt.Errorf("invalid logger length %q in pattern", opts[0])
+			}
+		}
+	}
+	return
+}
+
+// pad applies the format modifiers of p to s.
+func (p *patternPart) pad(buf []byte, s string) []byte {
+	if p.max > 0 && len(s) > p.max {
+		if p.truncateEnd {
+			s = s[:p.max]
+		} else {
+			s = s[len(s)-p.max:]
+		}
+	}
+	padding := p.min - len(s)
+	if !p.left {
+		for ; padding > 0; padding-- {
+			buf = append(buf, ' ')
+		}
+	}
+	buf = append(buf, s...)
+	for ; padding > 0; padding-- {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+// abbreviateLogger shortens a scope like github.com/iidesho/bragi/sbragi the way logback shortens class names.
+// The path elements are abbreviated whole, so github.com stays one element, and the last one is split on dots
+// like a logback name, so db.users are two. Starting from the left, elements are cut to their first letter
+// until the name fits in length, the last element is always kept whole. With a length of 12 the example
+// becomes g.i.b.sbragi.
+func abbreviateLogger(scope string, length int) string {
+	if length < 0 {
+		return strings.ReplaceAll(scope, "/", ".")
+	}
+	elems := strings.Split(scope, "/")
+	elems = append(elems[:len(elems)-1], strings.Split(elems[len(elems)-1], ".")...)
+	last := len(elems) - 1
+	if length == 0 {
+		return elems[last]
+	}
+	size := len(scope)
+	if size <= length {
+		return strings.Join(elems, ".")
+	}
+	for i := 0; i < last && size > length; i++ {
+		if len(elems[i]) > 1 {
+			size -= len(elems[i]) - 1
+			elems[i] = elems[i][:1]
+		}
+	}
+	return strings.Join(elems, ".")
+}
+
+// dateLayout formats times like a Java SimpleDateFormat pattern, which is what logback uses for %d.
+type dateLayout struct {
+	parts []func(buf []byte, t time.Time) []byte
+	loc   *time.Location
+}
+
+// parseDateLayout compiles a SimpleDateFormat pattern, an empty one or ISO8601 is logback's default.
+func parseDateLayout(layout, zone string) (*dateLayout, error) {
+	if layout == "" || layout == "ISO8601" {
+		layout = "yyyy-MM-dd HH:mm:ss,SSS"
+	}
+	d := &dateLayout{}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, err
+		}
+		d.loc = loc
+	}
+	for i := 0; i < len(layout); {
+		c := layout[i]
+		if c == '\'' {
+			end := strings.IndexByte(layout[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote in date pattern %q", layout)
+			}
+			lit := layout[i+1 : i+1+end]
+			if lit == "" {
+				lit = "'"
+			}
+			d.parts = append(d.parts, func(buf []byte, _ time.Time) []byte { return append(buf, lit...) })
+			i += end + 2
+			continue
+		}
+		if !unicode.IsLetter(rune(c)) {
+			d.parts = append(d.parts, func(buf []byte, _ time.Time) []byte { return append(buf, c) })
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(layout) && layout[i+n] == c {
+			n++
+		}
+		part, err := dateField(c, n)
+		if err != nil {
+			return nil, fmt.Errorf("%w in date pattern %q", err, layout)
+		}
+		d.parts = append(d.parts, part)
+		i += n
+	}
+	return d, nil
+}
+
+// dateField returns what formats n repetitions of the SimpleDateFormat letter c.
+func dateField(c byte, n int) (func(buf []byte, t time.Time) []byte, error) {
+	number := func(value func(t time.Time) int) func(buf []byte, t time.Time) []byte {
+		return func(buf []byte, t time.Time) []byte {
+			s := strconv.Itoa(value(t))
+			for i := len(s); i < n; i++ {
+				buf = append(buf, '0')
+			}
+			return append(buf, s...)
+		}
+	}
+	layout := func(l string) func(buf []byte, t time.Time) []byte {
+		return func(buf []byte, t time.Time) []byte { return t.AppendFormat(buf, l) }
+	}
+	switch c {
+	case 'y':
+		if n == 2 {
+			return layout("06"), nil
+		}
+		return number(time.Time.Year), nil
+	case 'M':
+		switch {
+		case n >= 4:
+			return layout("January"), nil
+		case n == 3:
+			return layout("Jan"), nil
+		}
+		return number(func(t time.Time) int { return int(t.Month()) }), nil
+	case 'd':
+		return number(time.Time.Day), nil
+	case 'H':
+		return number(time.Time.Hour), nil
+	case 'h':
+		return number(func(t time.Time) int { return (t.Hour()+11)%12 + 1 }), nil
+	case 'm':
+		return number(time.Time.Minute), nil
+	case 's':
+		return number(time.Time.Second), nil
+	case 'S':
+		return func(buf []byte, t time.Time) []byte {
+			s := fmt.Sprintf("%09d", t.Nanosecond())
+			if n < len(s) {
+				s = s[:n]
+			}
+			return append(buf, s...)
+		}, nil
+	case 'E':
+		if n >= 4 {
+			return layout("Monday"), nil
+		}
+		return layout("Mon"), nil
+	case 'a':
+		return layout("PM"), nil
+	case 'z':
+		return layout("MST"), nil
+	case 'Z':
+		return layout("-0700"), nil
+	case 'X':
+		switch n {
+		case 1:
+			return layout("Z07"), nil
+		case 2:
+			return layout("Z0700"), nil
+		}
+		return layout("Z07:00"), nil
+	}
+	return nil, fmt.Errorf("unsupported letter %q", c)
+}
+
+func (d *dateLayout) format(buf []byte, t time.Time) []byte {
+	if d.loc != nil {
+		t = t.In(d.loc)
+	}
+	for _, part := range d.parts {
+		buf = part(buf, t)
+	}
+	return buf
+}
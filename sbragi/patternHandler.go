@@ -0,0 +1,237 @@
+package sbragi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+// PatternHandler writes records as text laid out by a logback pattern, so services in Go and Java can share
+// the same human readable format. The supported conversion words are
+//
+//	%d{pattern, zone}  the time formatted like SimpleDateFormat, logback's ISO8601 default without a pattern
+//	%level             the level, with WARN for LevelWarning as in logback
+//	%logger{length}    the scope, or the package of the caller, abbreviated to length like logback does
+//	%file and %line    the source of the record, ? if it is not known
+//	%msg               the message
+//	%kv                the attributes as key="value", with the keys of groups joined by dots
+//	%ex                the error of the record, on its own line
+//	%n                 a newline
+//
+// together with the logback aliases of each of them and the format modifiers, like %-5level and %.-10msg.
+// A record always ends with a newline, even if the pattern does not.
+type PatternHandler struct {
+	mut    *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	parts  []patternPart
+	logger bool
+	ex     bool
+	// attrs are the attributes added with WithAttrs, prefix is the groups added with WithGroup
+	attrs  []patternAttr
+	prefix string
+	scope  string
+}
+
+// DefaultPattern is the pattern of the logback console appender, with the attributes and error of the record.
+const DefaultPattern = "%d{HH:mm:ss.SSS} %-5level %logger{36} - %msg %kv%n%ex"
+
+type patternAttr struct {
+	key   string
+	value slog.Value
+}
+
+// NewPatternHandler returns a handler writing to w with the layout of pattern. Only the Level of opts is used.
+func NewPatternHandler(w io.Writer, pattern string, opts *slog.HandlerOptions) (*PatternHandler, error) {
+	parts, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	h := &PatternHandler{
+		mut:   &sync.Mutex{},
+		w:     w,
+		level: LevelInfo,
+		parts: parts,
+	}
+	if opts != nil && opts.Level != nil {
+		h.level = opts.Level
+	}
+	for _, p := range parts {
+		switch p.kind {
+		case patternLogger:
+			h.logger = true
+		case patternException:
+			h.ex = true
+		}
+	}
+	return h, nil
+}
+
+func (h *PatternHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *PatternHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.attrs
+	if r.NumAttrs() > 0 {
+		attrs = append(make([]patternAttr, 0, len(h.attrs)+r.NumAttrs()), h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendPatternAttr(attrs, h.prefix, a)
+			return true
+		})
+	}
+	scope := h.scope
+	var err error
+	kv := attrs[:0:0]
+	for _, a := range attrs {
+		switch {
+		case h.logger && a.key == "scope":
+			scope = a.value.String()
+			continue
+		case h.ex && err == nil && a.value.Kind() == slog.KindAny:
+			if e, ok := a.value.Any().(error); ok {
+				err = e
+				continue
+			}
+		}
+		kv = append(kv, a)
+	}
+	var frame runtime.Frame
+	if r.PC != 0 {
+		frame, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+	if scope == "" {
+		scope = funcPackage(frame.Function)
+	}
+
+	buf := make([]byte, 0, 256)
+	for i := range h.parts {
+		p := &h.parts[i]
+		switch p.kind {
+		case patternLiteral:
+			buf = append(buf, p.literal...)
+		case patternDate:
+			buf = p.pad(buf, string(p.date.format(nil, r.Time)))
+		case patternLevel:
+			buf = p.pad(buf, logbackLevel(r.Level))
+		case patternLogger:
+			buf = p.pad(buf, abbreviateLogger(scope, p.length))
+		case patternFile:
+			file := "?"
+			if frame.File != "" {
+				file = filepath.Base(frame.File)
+			}
+			buf = p.pad(buf, file)
+		case patternLine:
+			line := "?"
+			if frame.Line > 0 {
+				line = strconv.Itoa(frame.Line)
+			}
+			buf = p.pad(buf, line)
+		case patternMessage:
+			buf = p.pad(buf, r.Message)
+		case patternKV:
+			buf = p.pad(buf, string(appendKV(nil, kv)))
+		case patternException:
+			if err == nil {
+				continue
+			}
+			if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+				buf = append(buf, '\n')
+			}
+			buf = p.pad(buf, fmt.Sprintf("%+v", err))
+		}
+	}
+	if len(buf) == 0 || buf[len(buf)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, werr := h.w.Write(buf)
+	return werr
+}
+
+func (h *PatternHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]patternAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		if h.logger && h.prefix == "" && a.Key == "scope" {
+			h2.scope = a.Value.String()
+			continue
+		}
+		h2.attrs = appendPatternAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *PatternHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendPatternAttr appends a to attrs with its key after prefix, with groups flattened into dotted keys.
+func appendPatternAttr(attrs []patternAttr, prefix string, a slog.Attr) []patternAttr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		return append(attrs, patternAttr{key: prefix + a.Key, value: a.Value})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = appendPatternAttr(attrs, prefix, ga)
+	}
+	return attrs
+}
+
+// appendKV appends attrs the way logback writes key value pairs, as key="value" separated by spaces.
+func appendKV(buf []byte, attrs []patternAttr) []byte {
+	for i, a := range attrs {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, a.key...)
+		buf = append(buf, '=', '"')
+		switch a.value.Kind() {
+		case slog.KindTime:
+			buf = a.value.Time().AppendFormat(buf, time.RFC3339Nano)
+		default:
+			buf = append(buf, a.value.String()...)
+		}
+		buf = append(buf, '"')
+	}
+	return buf
+}
+
+// logbackLevel names level like logback does, the levels logback does not have keep their sbragi names.
+func logbackLevel(level slog.Level) string {
+	if level == LevelWarning {
+		return "WARN"
+	}
+	return LevelToString(level)
+}
+
+// funcPackage returns the package of a function name from runtime, like github.com/iidesho/bragi/sbragi
+// for github.com/iidesho/bragi/sbragi.(*logger).log.
+func funcPackage(function string) string {
+	pkg, _ := bragi.SplitFunction(function)
+	return pkg
+}
@@ -0,0 +1,89 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// caller returns the pc and line it was called from.
+func caller() (uintptr, int) {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	return pcs[0], frame.Line
+}
+
+func TestAbbreviateLogger(t *testing.T) {
+	for _, tc := range []struct {
+		length   int
+		expected string
+	}{
+		{-1, "github.com.iidesho.bragi.sbragi"},
+		{0, "sbragi"},
+		{5, "g.i.b.sbragi"},
+		{12, "g.i.b.sbragi"},
+		{20, "g.i.bragi.sbragi"},
+		{40, "github.com.iidesho.bragi.sbragi"},
+	} {
+		if got := abbreviateLogger("github.com/iidesho/bragi/sbragi", tc.length); got != tc.expected {
+			t.Errorf("expected %q with length %d, got %q", tc.expected, tc.length, got)
+		}
+	}
+	for _, tc := range []struct {
+		scope    string
+		length   int
+		expected string
+	}{
+		{"com.example.payments.Service", 20, "c.e.payments.Service"},
+		{"app/db.users", 8, "a.d.users"},
+		{"example.com/app/db.users", 12, "e.a.db.users"},
+		{"example.com/app/db.users", 0, "users"},
+		{"payments", 0, "payments"},
+		{"payments", 3, "payments"},
+		{"payments", -1, "payments"},
+	} {
+		if got := abbreviateLogger(tc.scope, tc.length); got != tc.expected {
+			t.Errorf("expected %q for %q with length %d, got %q", tc.expected, tc.scope, tc.length, got)
+		}
+	}
+}
+
+func TestPatternHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h, err := NewPatternHandler(&buf, "%d{yyyy-MM-dd'T'HH:mm:ss.SSS, UTC} [%-5level] %logger{12} %file:%line - %msg %kv%n%ex", &slog.HandlerOptions{Level: LevelTrace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, line := caller()
+	r := slog.NewRecord(time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.UTC), LevelWarning, "unable to connect", pc)
+	r.AddAttrs(slog.Any("error", errors.New("connection refused")), slog.Int("attempt", 3))
+	log := h.WithAttrs([]slog.Attr{slog.String("scope", "github.com/iidesho/bragi/sbragi")}).WithGroup("db")
+	if err = log.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("2024-01-02T03:04:05.006 [WARN ] g.i.b.sbragi patternHandler_test.go:%d - unable to connect db.attempt=\"3\"\nconnection refused\n", line)
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	r = slog.NewRecord(time.Now(), LevelNotice, "no error", 0)
+	if err = h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String()[24:]; got != "[NOTICE]  ?:? - no error \n" {
+		t.Errorf("expected the record without source, scope or attributes, got %q", got)
+	}
+
+	for _, pattern := range []string{"%nope", "%d{yyyy-MM-dd Q}", "%logger{x}", "%msg%"} {
+		if _, err = NewPatternHandler(&buf, pattern, nil); err == nil {
+			t.Errorf("expected %q to be rejected", pattern)
+		}
+	}
+}
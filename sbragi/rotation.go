@@ -0,0 +1,78 @@
+package sbragi
+
+import (
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+type Schedule int
+
+const (
+	ScheduleNone Schedule = iota
+	ScheduleHourly
+	ScheduleDaily
+)
+
+// RotationPolicy decides when a log stream is moved aside and a new segment is started.
+// Zero values disable the corresponding rule.
+type RotationPolicy struct {
+	// MaxSize rotates the stream when its file reaches this many bytes.
+	MaxSize int64
+	// MaxAge rotates the stream when the current segment has been open this long.
+	MaxAge time.Duration
+	// Schedule rotates the stream on every hour or day boundary in Location.
+	Schedule Schedule
+	// Location is the time zone the schedule is evaluated in, nil means UTC.
+	Location *time.Location
+	// OnStartup rotates a non empty segment left by a previous run before logging starts.
+	OnStartup bool
+	// PollInterval is how often the limits are checked, defaults to one second.
+	PollInterval time.Duration
+}
+
+// DefaultRotationPolicy is the policy used when none is given, rotating at 24MB and at UTC midnight.
+var DefaultRotationPolicy = RotationPolicy{
+	MaxSize:      24 * bragi.MB,
+	Schedule:     ScheduleDaily,
+	Location:     time.UTC,
+	PollInterval: time.Second,
+}
+
+func (p RotationPolicy) pollInterval() time.Duration {
+	if p.PollInterval <= 0 {
+		return time.Second
+	}
+	return p.PollInterval
+}
+
+// nextBoundary returns the first schedule boundary after t, or the zero time if there is no schedule.
+func (p RotationPolicy) nextBoundary(t time.Time) time.Time {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	switch p.Schedule {
+	case ScheduleHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+	case ScheduleDaily:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+	default:
+		return time.Time{}
+	}
+}
+
+// due reports if a segment opened at opened with the given size should be rotated at now.
+func (p RotationPolicy) due(now, opened, next time.Time, size int64) bool {
+	if size == 0 {
+		return false
+	}
+	if p.MaxSize > 0 && size >= p.MaxSize {
+		return true
+	}
+	if p.MaxAge > 0 && now.Sub(opened) >= p.MaxAge {
+		return true
+	}
+	return !next.IsZero() && !now.Before(next)
+}
@@ -0,0 +1,47 @@
+package sbragi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotationPolicyNextBoundary(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2026, 10, 24, 23, 30, 0, 0, time.UTC)
+	p := RotationPolicy{Schedule: ScheduleDaily, Location: oslo}
+	next := p.nextBoundary(now)
+	if want := time.Date(2026, 10, 26, 0, 0, 0, 0, oslo); !next.Equal(want) {
+		t.Errorf("daily boundary was %v, expected %v", next, want)
+	}
+	p = RotationPolicy{Schedule: ScheduleHourly}
+	next = p.nextBoundary(now)
+	if want := time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("hourly boundary was %v, expected %v", next, want)
+	}
+	if !(RotationPolicy{}).nextBoundary(now).IsZero() {
+		t.Error("policy without schedule should not have a boundary")
+	}
+}
+
+func TestRotationPolicyDue(t *testing.T) {
+	now := time.Now()
+	p := RotationPolicy{MaxSize: 10, MaxAge: time.Hour}
+	if p.due(now, now, time.Time{}, 0) {
+		t.Error("empty segment should never be due")
+	}
+	if !p.due(now, now, time.Time{}, 10) {
+		t.Error("segment at max size should be due")
+	}
+	if !p.due(now, now.Add(-time.Hour), time.Time{}, 1) {
+		t.Error("segment at max age should be due")
+	}
+	if !p.due(now, now, now, 1) {
+		t.Error("segment past schedule boundary should be due")
+	}
+	if p.due(now, now, now.Add(time.Minute), 1) {
+		t.Error("segment within all limits should not be due")
+	}
+}
@@ -0,0 +1,134 @@
+package sbragi
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/iidesho/bragi"
+)
+
+// Format is how records are written to a log file.
+type Format int
+
+const (
+	// FormatText is the human readable format of the folder, logback or logfmt if the handler has a pattern or WithLogfmt
+	FormatText Format = iota
+	// FormatJSON is the json format of the folder, the one set with WithJSONFormat
+	FormatJSON
+	FormatLogfmt
+	// FormatECS is json in the Elastic Common Schema, see ECSHandler
+	FormatECS
+	// FormatLogstash is json in the layout of logstash-logback-encoder, see LogstashHandler
+	FormatLogstash
+)
+
+// Route is a log file next to the main one that only gets the records within a level range,
+// like an errors.log with everything at LevelWarning and above.
+type Route struct {
+	// Prefix names the file, errors gives errors.log
+	Prefix string
+	// MinLevel and MaxLevel bound the levels of the records in the file, nil leaves that end open
+	MinLevel slog.Leveler
+	MaxLevel slog.Leveler
+	Format   Format
+	// Policy and Retention default to the ones of the human readable stream when nil
+	Policy    *RotationPolicy
+	Retention *bragi.Retention
+}
+
+func (r Route) includes(level slog.Level) bool {
+	if r.MinLevel != nil && level < r.MinLevel.Level() {
+		return false
+	}
+	if r.MaxLevel != nil && level > r.MaxLevel.Level() {
+		return false
+	}
+	return true
+}
+
+// routeHandler writes the records of a route to its stream.
+type routeHandler struct {
+	route   Route
+	handler slog.Handler
+	stream  *stream
+}
+
+// WithRoute adds a log file for the records in the level range of r. The file is rotated and retained on its own,
+// and is not created until a record for it is logged, so a trace.log does not exist until TRACE is turned on.
+func WithRoute(r Route) FolderOption {
+	return func(h *fileHandler) {
+		h.routeConfigs = append(h.routeConfigs, r)
+	}
+}
+
+// newRouteStreams adds a stream for every route, and returns the live files left by a previous run.
+// The file is nil for routes that have not been written to yet.
+func (h *fileHandler) newRouteStreams() (files []bragi.File, err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for _, r := range h.routeConfigs {
+		path := filepath.Join(h.folder, r.Prefix+".log")
+		// The current.log symlink of the main stream would replace the live file of a route named like it
+		if r.Prefix+".log" == bragi.CurrentLink {
+			return files, fmt.Errorf("route prefix %q is reserved", r.Prefix)
+		}
+		for _, s := range h.streams {
+			if r.Prefix == "" || (s.dir == h.folder && s.prefix == r.Prefix) {
+				return files, fmt.Errorf("route prefix %q is already in use", r.Prefix)
+			}
+		}
+		policy := h.policyHuman
+		if r.Policy != nil {
+			policy = *r.Policy
+		}
+		retention := h.retention
+		if r.Retention != nil {
+			retention = *r.Retention
+		}
+		s := h.newStream(r.Prefix, path, policy, retention)
+		s.routed = true
+		h.streams = append(h.streams, s)
+		var f bragi.File
+		if bragi.Exists(h.fsys, path) {
+			f, err = bragi.OpenLogFile(h.fsys, h.folder, r.Prefix)
+			if err != nil {
+				return
+			}
+		}
+		files = append(files, f)
+	}
+	return
+}
+
+// newRouteHandlers creates the handlers writing to the opened route streams.
+func (h *fileHandler) newRouteHandlers(textOpt, jsonOpt *slog.HandlerOptions) {
+	for i, r := range h.routeConfigs {
+		s := h.streams[2+i]
+		switch r.Format {
+		case FormatJSON:
+			s.handler = h.newJSONHandler(s.writer(), jsonOpt)
+		case FormatECS:
+			s.handler = NewECSHandler(s.writer(), jsonOpt)
+		case FormatLogstash:
+			s.handler = NewLogstashHandler(s.writer(), jsonOpt)
+		case FormatLogfmt:
+			s.handler = NewLogfmtHandler(s.writer(), textOpt)
+		default:
+			s.handler = h.newTextHandler(s.writer(), textOpt)
+		}
+		h.routes = append(h.routes, routeHandler{
+			route:   r,
+			handler: s.handler,
+			stream:  s,
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package sbragi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ScopeRoute sends the records of every scope starting with Scope to the sink named Sink.
+// Scope can start at any path element of the scope, so db matches github.com/acme/svc/db.
+type ScopeRoute struct {
+	Scope string
+	Sink  string
+}
+
+type scopeRoutes struct {
+	mut    sync.RWMutex
+	routes []ScopeRoute
+	// watchers reload the routes from the files given to AttachRoutes, reloads waits for their goroutines
+	watchers []*fsnotify.Watcher
+	reloads  sync.WaitGroup
+}
+
+// ScopeRouter sends records to named sinks by the scope attribute set by WithLocalScope,
+// records without a matching route go to the fallback. The most specific route wins.
+type ScopeRouter struct {
+	fallback slog.Handler
+	sinks    map[string]slog.Handler
+	routes   *scopeRoutes
+	// scope is set if it was added with WithAttrs
+	scope string
+}
+
+func NewScopeRouter(fallback slog.Handler, sinks map[string]slog.Handler, routes ...ScopeRoute) *ScopeRouter {
+	h := &ScopeRouter{
+		fallback: fallback,
+		sinks:    sinks,
+		routes:   &scopeRoutes{},
+	}
+	h.SetRoutes(routes)
+	return h
+}
+
+// SetRoutes replaces the routes of h and every handler derived from it.
+func (h *ScopeRouter) SetRoutes(routes []ScopeRoute) {
+	routes = append([]ScopeRoute(nil), routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Scope) > len(routes[j].Scope)
+	})
+	h.routes.mut.Lock()
+	h.routes.routes = routes
+	h.routes.mut.Unlock()
+}
+
+// AttachRoutes reads the routes from config and reloads them every time it is written to.
+// Each line is a scope and the sink for it, like the scopes file of AttachDynamicScopes:
+//
+//	db: db
+//	http/access: access
+func (h *ScopeRouter) AttachRoutes(config string) error {
+	f, err := os.OpenFile(config, os.O_CREATE|os.O_RDONLY, 0640)
+	if err != nil {
+		return err
+	}
+	h.SetRoutes(readScopeRoutes(f))
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = watcher.Add(config)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	h.routes.mut.Lock()
+	h.routes.watchers = append(h.routes.watchers, watcher)
+	h.routes.mut.Unlock()
+	h.routes.reloads.Add(1)
+	go func(events chan fsnotify.Event) {
+		defer h.routes.reloads.Done()
+		for e := range events {
+			if !e.Op.Has(fsnotify.Write) {
+				continue
+			}
+			log.Info("Scope routes changed, reloading...", "config", config)
+			f, err := os.OpenFile(config, os.O_RDONLY, 0640)
+			if log.WithError(err).Error("could not open scope routes file") {
+				continue
+			}
+			h.SetRoutes(readScopeRoutes(f))
+		}
+	}(watcher.Events)
+	return nil
+}
+
+// Flush flushes the fallback and every sink that can be flushed.
+func (h *ScopeRouter) Flush(ctx context.Context) error {
+	errs := []error{flushHandler(ctx, h.fallback)}
+	for name, s := range h.sinks {
+		err := flushHandler(ctx, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops reloading the routes and closes the fallback and every sink that can be closed.
+// Routes are shared by every handler derived from h, so closing any of them stops the reloading for all.
+func (h *ScopeRouter) Close(ctx context.Context) error {
+	h.routes.mut.Lock()
+	watchers := h.routes.watchers
+	h.routes.watchers = nil
+	h.routes.mut.Unlock()
+	var errs []error
+	for _, w := range watchers {
+		errs = append(errs, w.Close())
+	}
+	h.routes.reloads.Wait()
+	errs = append(errs, closeHandler(ctx, h.fallback))
+	for name, s := range h.sinks {
+		err := closeHandler(ctx, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func readScopeRoutes(f io.ReadCloser) []ScopeRoute {
+	defer log.WithErrorFunc(f.Close).Trace("closed scope routes file")
+	bf := bufio.NewScanner(f)
+	routes := []ScopeRoute{}
+	for bf.Scan() {
+		scope, sink, ok := strings.Cut(bf.Text(), ":")
+		if !ok {
+			continue
+		}
+		routes = append(routes, ScopeRoute{
+			Scope: strings.TrimSpace(scope),
+			Sink:  strings.TrimSpace(sink),
+		})
+	}
+	return routes
+}
+
+// matchesScope reports if prefix is the start of scope or of one of its path elements. The prefix has to end
+// where an element, or a dotted part of one, does, so http matches http/access and http.v2 but not httputil.
+func matchesScope(scope, prefix string) bool {
+	for {
+		if rest, ok := strings.CutPrefix(scope, prefix); ok &&
+			(rest == "" || rest[0] == '/' || rest[0] == '.' || strings.HasSuffix(prefix, "/")) {
+			return true
+		}
+		i := strings.IndexByte(scope, '/')
+		if i < 0 {
+			return false
+		}
+		scope = scope[i+1:]
+	}
+}
+
+func (h *ScopeRouter) sink(scope string) slog.Handler {
+	if scope == "" {
+		return h.fallback
+	}
+	h.routes.mut.RLock()
+	defer h.routes.mut.RUnlock()
+	for _, r := range h.routes.routes {
+		if !matchesScope(scope, r.Scope) {
+			continue
+		}
+		if s, ok := h.sinks[r.Sink]; ok {
+			return s
+		}
+	}
+	return h.fallback
+}
+
+func (h *ScopeRouter) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.fallback.Enabled(ctx, level) {
+		return true
+	}
+	for _, s := range h.sinks {
+		if s.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ScopeRouter) Handle(ctx context.Context, r slog.Record) error {
+	scope := h.scope
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != "scope" {
+			return true
+		}
+		scope = a.Value.String()
+		return false
+	})
+	s := h.sink(scope)
+	if !s.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return s.Handle(ctx, r)
+}
+
+func (h *ScopeRouter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.derive(func(s slog.Handler) slog.Handler {
+		return s.WithAttrs(attrs)
+	})
+	for _, a := range attrs {
+		if a.Key == "scope" {
+			h2.scope = a.Value.String()
+		}
+	}
+	return h2
+}
+
+func (h *ScopeRouter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.derive(func(s slog.Handler) slog.Handler {
+		return s.WithGroup(name)
+	})
+}
+
+func (h *ScopeRouter) derive(fn func(slog.Handler) slog.Handler) *ScopeRouter {
+	sinks := make(map[string]slog.Handler, len(h.sinks))
+	for name, s := range h.sinks {
+		sinks[name] = fn(s)
+	}
+	return &ScopeRouter{
+		fallback: fn(h.fallback),
+		sinks:    sinks,
+		routes:   h.routes,
+		scope:    h.scope,
+	}
+}
@@ -0,0 +1,93 @@
+package sbragi
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopeRouter(t *testing.T) {
+	var app, db, access bytes.Buffer
+	newSink := func(b *bytes.Buffer) slog.Handler {
+		return slog.NewTextHandler(b, &slog.HandlerOptions{Level: LevelTrace})
+	}
+	config := filepath.Join(t.TempDir(), "routes.conf")
+	if err := os.WriteFile(config, []byte("db: db\nhttp/access: access\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	h := NewScopeRouter(newSink(&app), map[string]slog.Handler{
+		"db":     newSink(&db),
+		"access": newSink(&access),
+	})
+	if err := h.AttachRoutes(config); err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(h)
+	log.Info("query", "scope", "github.com/acme/svc/db")
+	log.Info("request", "scope", "github.com/acme/svc/http/access")
+	log.Info("started", "scope", "github.com/acme/svc/http")
+	log.With("scope", "github.com/acme/svc/db/migrations").Info("migrated")
+	log.Info("no scope")
+
+	for _, tc := range []struct {
+		name     string
+		buf      *bytes.Buffer
+		expected []string
+	}{
+		{"db", &db, []string{"msg=query", "msg=migrated"}},
+		{"access", &access, []string{"msg=request"}},
+		{"app", &app, []string{"msg=started", `msg="no scope"`}},
+	} {
+		lines := strings.Split(strings.TrimSpace(tc.buf.String()), "\n")
+		if len(lines) != len(tc.expected) {
+			t.Errorf("expected %d records in %s, got %q", len(tc.expected), tc.name, tc.buf.String())
+			continue
+		}
+		for i, msg := range tc.expected {
+			if !strings.Contains(lines[i], msg) {
+				t.Errorf("expected %s in %s, got %q", msg, tc.name, lines[i])
+			}
+		}
+	}
+
+	if h.sink("github.com/acme/svc/dbmigrate") != h.fallback {
+		t.Error("expected dbmigrate to not match the db route")
+	}
+
+	if err := os.WriteFile(config, []byte("http: access\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for h.sink("github.com/acme/svc/http") == h.fallback && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	access.Reset()
+	log.Info("reloaded", "scope", "github.com/acme/svc/http")
+	log.Info("back to app", "scope", "github.com/acme/svc/db")
+	if !strings.Contains(access.String(), "msg=reloaded") || !strings.Contains(app.String(), `msg="back to app"`) {
+		t.Errorf("expected the reloaded routes to be used, got %q in access and %q in app", access.String(), app.String())
+	}
+
+	if h.sink("github.com/acme/svc/httputil") != h.fallback {
+		t.Error("expected httputil to not match the http route")
+	}
+	if h.sink("github.com/acme/svc/http.v2") == h.fallback {
+		t.Error("expected http.v2 to match the http route")
+	}
+
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte("db: access\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if h.sink("github.com/acme/svc/db") != h.fallback {
+		t.Error("expected the routes to stay as they were after Close")
+	}
+}
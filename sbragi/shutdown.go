@@ -0,0 +1,45 @@
+package sbragi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Closer is a handler that has to be closed, to write out what it holds and stop its goroutines.
+// Closing more than once is safe, and records handled after Close are not kept.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Flusher is a handler that can write out what it holds without being closed.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// fatalFlushTimeout is how long Fatal waits for the handlers to write out pending records before panicking.
+const fatalFlushTimeout = 5 * time.Second
+
+// Shutdown closes the handler chain of the default logger, with every handler in it that can be closed,
+// or gives up when ctx is done. Logging after Shutdown is not kept.
+func Shutdown(ctx context.Context) error {
+	return closeHandler(ctx, defaultLogger.handler)
+}
+
+// closeHandler closes h if it can be closed.
+func closeHandler(ctx context.Context, h slog.Handler) error {
+	c, ok := h.(Closer)
+	if !ok {
+		return nil
+	}
+	return c.Close(ctx)
+}
+
+// flushHandler flushes h if it can be flushed.
+func flushHandler(ctx context.Context, h slog.Handler) error {
+	f, ok := h.(Flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush(ctx)
+}
@@ -0,0 +1,47 @@
+package sbragi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHandlerInFolder(dir, WithBuffering(BufferPolicy{FlushInterval: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	async := NewAsyncHandler(NewMultiHandler(Sink{Handler: &h}))
+	l, err := NewLogger(async)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := defaultLogger
+	defer func() {
+		defaultLogger = old
+	}()
+	l.SetDefault()
+	for i := range 100 {
+		Info("before shutdown", "record", i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("closing again should be a no-op, got %v", err)
+	}
+	if lines, _ := countLines(t, dir, false); lines != 100 {
+		t.Errorf("expected every buffered and queued record to be written, found %d", lines)
+	}
+	err = h.Handle(ctx, slog.NewRecord(time.Now(), LevelInfo, "after shutdown", 0))
+	if !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the handler to be closed, got %v", err)
+	}
+}
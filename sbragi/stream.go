@@ -0,0 +1,278 @@
+package sbragi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/iidesho/bragi"
+)
+
+// stream is one live log file in the folder, rotated, compressed and retained on its own.
+type stream struct {
+	name   string
+	dir    string
+	prefix string
+	file   *logFile
+	// out falls back to stderr while file is failing
+	out *bragi.Failover
+	// buf batches writes to out if the handler is buffered
+	buf *bufferedWriter
+	// handler is the handler of the stream without any attrs or groups, used for records of its own
+	handler   slog.Handler
+	lock      *bragi.FolderLock
+	policy    RotationPolicy
+	retention bragi.Retention
+	// routed streams leave the current.log symlink to the main stream in the folder
+	routed bool
+	// state is only touched by the rotation goroutine
+	state rotationState
+}
+
+type rotationState struct {
+	opened time.Time
+	next   time.Time
+}
+
+func newRotationState(p RotationPolicy, now time.Time) rotationState {
+	return rotationState{
+		opened: now,
+		next:   p.nextBoundary(now),
+	}
+}
+
+// check reports if f is due for rotation. A schedule boundary passed while the segment is empty is skipped.
+func (s *rotationState) check(p RotationPolicy, f *logFile, now time.Time) (bool, error) {
+	size, err := f.Size()
+	if err != nil {
+		return false, err
+	}
+	if p.due(now, s.opened, s.next, size) {
+		return true, nil
+	}
+	if !s.next.IsZero() && !now.Before(s.next) {
+		s.next = p.nextBoundary(now)
+	}
+	return false, nil
+}
+
+// writer is what the handlers of s write to.
+func (s *stream) writer() io.Writer {
+	if s.buf != nil {
+		return s.buf
+	}
+	return s.out
+}
+
+// flush writes what s has buffered to the live file.
+func (h *fileHandler) flush(s *stream) {
+	err := s.buf.Flush()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to flush log buffer", err, "stream", s.name)
+	}
+}
+
+// sync writes what s has buffered and commits the live file to disk.
+func (h *fileHandler) sync(s *stream) {
+	h.flush(s)
+	err := s.file.sync()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to sync log file", err, "stream", s.name)
+	}
+}
+
+func (h *fileHandler) newStream(name, path string, p RotationPolicy, r bragi.Retention) *stream {
+	s := &stream{
+		name:      name,
+		dir:       filepath.Dir(path),
+		prefix:    filePrefix(path),
+		policy:    p,
+		retention: r,
+	}
+	if h.coordinated {
+		s.lock = bragi.NewFolderLock(s.dir)
+	}
+	return s
+}
+
+// open rotates what a previous run left behind if the policy asks for it and starts writing to the live file.
+// Without a live file the stream creates it when it is first written to.
+func (h *fileHandler) open(s *stream, f bragi.File) (err error) {
+	if f == nil {
+		s.file = newLazyLogFile(h.fsys, filepath.Join(s.dir, s.prefix+".log"))
+		s.out = bragi.NewFailover(s.file)
+		s.out.SetClock(h.clock)
+		return
+	}
+	var rotated string
+	if s.policy.OnStartup && !h.external {
+		f, rotated, err = h.rotateOnStartup(s, f)
+		if err != nil {
+			return
+		}
+	}
+	live := f.Name()
+	s.file = newLogFile(h.fsys, f)
+	s.out = bragi.NewFailover(s.file)
+	s.out.SetClock(h.clock)
+	if rotated != "" {
+		h.hooks.Rotated(live, rotated)
+		h.compressor.Enqueue(s.dir, rotated)
+	}
+	return
+}
+
+func (h *fileHandler) rotateOnStartup(s *stream, f bragi.File) (nf bragi.File, rotated string, err error) {
+	err = s.lock.Lock()
+	if err != nil {
+		return f, "", err
+	}
+	defer s.lock.Unlock()
+	stat, err := f.Stat()
+	if err != nil {
+		return f, "", err
+	}
+	if stat.Size() == 0 {
+		return f, "", nil
+	}
+	nf, rotated, err = bragi.RotateFile(h.fsys, f, h.naming, h.clock.Now())
+	if err != nil {
+		return f, "", err
+	}
+	f.Close()
+	h.refreshManifest(s)
+	return
+}
+
+func (h *fileHandler) rotateIfDue(s *stream, now time.Time) {
+	rotated, err := h.rotateLocked(s, now)
+	if err != nil {
+		h.diagnostics.Report(bragi.CRIT, "unable to rotate", err, "stream", s.name)
+		return
+	}
+	// Enqueued without the folder lock, as the compressor can be waiting for it
+	if rotated != "" {
+		h.hooks.Rotated(s.file.Name(), rotated)
+		h.compressor.Enqueue(s.dir, rotated)
+	}
+}
+
+func (h *fileHandler) rotateLocked(s *stream, now time.Time) (rotated string, err error) {
+	err = s.lock.Lock()
+	if err != nil {
+		return
+	}
+	defer s.lock.Unlock()
+	// Buffered records belong in the segment being rotated away
+	h.flush(s)
+	if h.coordinated {
+		reopened, err := s.file.follow()
+		if err != nil {
+			return "", err
+		}
+		if reopened {
+			// Another process rotated the segment, so this one starts fresh as well
+			s.state = newRotationState(s.policy, now)
+			return "", nil
+		}
+	}
+	rotate, err := s.state.check(s.policy, s.file, now)
+	if err != nil || !rotate {
+		return
+	}
+	rotated, err = s.file.rotate(h.naming, now)
+	if err != nil {
+		return
+	}
+	s.state = newRotationState(s.policy, now)
+	h.refreshManifest(s)
+	return
+}
+
+func (h *fileHandler) applyRetention(s *stream) {
+	err := s.lock.Lock()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to lock log folder", err, "dir", s.dir)
+		return
+	}
+	defer s.lock.Unlock()
+	removed, err := bragi.ApplyRetention(h.fsys, s.dir, s.prefix, h.naming, s.retention, h.clock.Now(), h.hooks)
+	if len(removed) > 0 {
+		h.diagnostics.Report(bragi.NOTICE, "removed old log segments", nil, "dir", s.dir, "segments", removed)
+	}
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to remove old log segments", err, "dir", s.dir)
+	}
+	h.refreshManifest(s)
+}
+
+// handle writes r with handler, and reports what was lost from the stream if it just recovered from failing writes.
+func (h *fileHandler) handle(ctx context.Context, handler slog.Handler, s *stream, r slog.Record) error {
+	err := handler.Handle(ctx, r)
+	if h.buffering != nil && h.buffering.flushes(r.Level) {
+		h.sync(s)
+	}
+	loss, ok := s.out.Recovered()
+	if !ok {
+		return err
+	}
+	summary := slog.NewRecord(h.clock.Now(), LevelWarning, loss.String(), 0)
+	summary.AddAttrs(
+		slog.Int64("records", loss.Records),
+		slog.Int64("bytes", loss.Bytes),
+		slog.Time("from", loss.From),
+		slog.Time("to", loss.To),
+	)
+	return errors.Join(err, s.handler.Handle(ctx, summary))
+}
+
+// followExternal reopens the live segment of s if an external tool has moved it away,
+// and notes when it has been truncated.
+func (h *fileHandler) followExternal(s *stream) {
+	h.flush(s)
+	_, err := s.file.follow()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to check if log file was rotated", err, "stream", s.name)
+		return
+	}
+	truncated, err := s.file.truncated()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to check if log file was truncated", err, "stream", s.name)
+		return
+	}
+	if truncated {
+		h.diagnostics.Report(bragi.NOTICE, "log file was truncated by an external tool, continuing at the start of the file", nil, "stream", s.name)
+	}
+}
+
+// updateManifest locks the folder of s and brings its manifest up to date.
+func (h *fileHandler) updateManifest(s *stream) {
+	if !h.manifest {
+		return
+	}
+	err := s.lock.Lock()
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to lock log folder", err, "dir", s.dir)
+		return
+	}
+	defer s.lock.Unlock()
+	h.refreshManifest(s)
+}
+
+// refreshManifest brings the manifest of s up to date, the folder has to be locked.
+func (h *fileHandler) refreshManifest(s *stream) {
+	if !h.manifest {
+		return
+	}
+	update := bragi.UpdateManifest
+	if s.routed {
+		update = bragi.WriteManifest
+	}
+	_, err := update(h.fsys, s.dir, s.prefix, h.naming, h.clock.Now())
+	if err != nil {
+		h.diagnostics.Report(bragi.ERROR, "unable to update log manifest", err, "stream", s.name)
+	}
+}